@@ -2,10 +2,15 @@ package dbg
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"os"
-	"path"
+	"reflect"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /*
@@ -17,14 +22,21 @@ import (
 		chk_args:		[fmt_args,] [CLOSER()]
 							any CLOSER() func is called before doing
 							the panic or exit for a failure case
-		trc_args:		[error] | [nil(error)] | [fmt_args]
+		-- for the Chk & fatal funcs a lone fmtStr (no arguments) is output as
+		   is, without formatting, so a stray '%' isn't an issue
+		trc_args:		[error] | [nil(error)] | [fmt_args] | [values...]
+							values not starting with a fmtStr are output
+							 space separated, as fmt.Sprintln
 
 	These are simple text output functions that will output colored text
 	-- there are multiple versions of these:
 		one through the package 'dbg.Info' dbg.Info( [fmt_args] )
 		one through the 'Dbg struct{bool}' bug.Info( [fmt_args] )
+		  whose output can go to its own writers, see the Dbg Out & Err fields
 		one through the 'DbgLvl struct'    dlvl.Info( 5, [fmt_args] )
 		one through the 'dbgMsk struct'    dmsk.Info( 0x8, [fmt_args] )
+		  or with a name given to the mask dmsk.InfoN( "parser", [fmt_args] )
+		    -- see RegisterMask, DbgMsk.Enable( name ) & DbgMsk.Disable( name )
 
 	Echo( [fmt_args] )						output normal text (quick way to do output w/o 'fmt' if you want)
 	Note( [fmt_args] )						output colored text (Blue)
@@ -36,30 +48,132 @@ import (
 	Failed( [fmt_args] )					output colored text (Magenta)
 	Error( [fmt_args] )						output colored text (Red)
 	Danger( [fmt_args] )					output colored text (White on Red)
+	Badge( label, [fmt_args] )				output label as a badge (Black on Cyan) followed by the text
+	SetBadgeColor( label, sgr )				set the badge color of label, e.g. "30;42" Black on Green
+
+	Clip( [fmt_args] )						output colored text (Cyan), also copying it to the clipboard
 
 	Color()									Enable colored text output (if system supports it)
 	NoColor()								Disable colored text output
+	ColorEnabled() bool						returns true if colored text output is enabled
+	SetColorRGB( Level, r, g, b ) bool		use a 24-bit color for Level if $COLORTERM is truecolor
+	ColorTest()								output a line per level in its color, a legend of the colors
+
+	Persist( Level, [fmt_args] )			output text colored per Level, also writing to any
+											 SetPersist( io.Writer ) so it survives a terminal clear
+
+	InfoKV( msg, fields... )				output msg (Green) followed by key=value fields
+	WarningKV( msg, fields... )				output msg (Orange) followed by key=value fields
+	ErrorKV( msg, fields... )				output msg (Red) followed by key=value fields
+											 fields are given by F( key, value ) Field
+	Ordered( Level, msg, keys, vals )		output msg followed by key=value fields in the order of keys
+	InfoCtx( ctx, [fmt_args] )				output colored text (Green) followed by fields of the context
+											 -- also EchoCtx, NoteCtx, ..., ErrorCtx & DangerCtx
+	WithContextExtractor( name, key )		add the value of the context key as the named field
+	SetContextFields( func(ctx) []Field )	set how fields (e.g. a request ID) are pulled from a context
+	SetBaseContext( context.Context )		add the fields of the context to the end of all output
+
+	SetLocationSeparator( string )			set separator between TRC/CHK location & message
+	SetTags( trc, was, chk, err )			set tags starting TRC, TRCFROM, CHK & ERR output ("" for none)
+	SetLocationForLevel( Level, bool )		show callers location on simple output at Level
+	SetShowCaller( bool )					show callers location on simple output at all Levels
+	SetTimestamp( layout )					start each line with a timestamp ("" for none)
+	SetPrefix( string )						start each line with the prefix ("" for none)
+	SetFormat( Format )						set output to FormatText (default), FormatJSON or FormatLogfmt
+	EnableHostname( bool )					start each line with the short host name
+	SetClock( func() time.Time )			set clock used for timestamps & elapsed times
+	SetSample( n )							output only 1 of every n calls of each call site
+	SetAutoNewline( bool )					end each output with a newline (default), false for building lines
+	SetMaxWidth( cols )						soft wrap output lines longer than cols (0 for no wrapping)
+	SetFailureHook( func(Level, msg) )		call func after each failed, error & danger line is output
+	SetExitFunc( func(int) )				set func used to exit by the fatal funcs (nil for os.Exit)
+	Flush()									flush (or sync) the output writers, done before fatal exits & panics
+	SetStrictFormat( bool )					warn with location on format verb / arg mismatches
+	SetExitCode( int )						set exit code of the fatal funcs (default -1)
+	RouteLevel( Level, io.Writer )			route output at Level to the writer (nil to restore)
+	RouteLevelScoped( Level, io.Writer ) func()
+											 route output at Level, returning func to restore
+	SetStream( Level, Stream )				send output at Level to OutStream or ErrStream (DefaultStream to restore)
+	EnableErrorNumbers( bool )				number error lines [#1], [#2], ...
+	SetRateLimit( time.Duration )			suppress identical lines output within the duration
+	SetBurst( capacity, time.Duration )		allow bursts of output, throttled to a line per duration after
+	Once( key, func() )						run func only the first time the key is seen
+	WarningOnce( [fmt_args] )				output colored text (Orange) only the first time for fmtStr
+	InfoNth( n, [fmt_args] )				output colored text (Green) only on the nth call from the site
+	ResetOnce()								forget all keys seen so they run again
+	InfoProb( p, [fmt_args] )				output colored text (Green) with a probability of p (0..1)
+	SetSampleSeed( int64 )					seed the generator used by InfoProb
+	SetMinLevel( Level )					filter output below the given Level (EchoLevel...DangerLevel)
+	Silence()								skip all output & its formatting (but Fatal / Panic)
+	Unsilence()								undo Silence
+	Quiet() func()							skip all output (as Silence) until the func is called:
+											 defer dbg.Quiet()()
+	IfActive( Level, func() )				only run func if output at Level is not filtered
 
 	ExpErr( err, err ) bool					output error if expected error is not given
+	ExpErrIs( err, err ) bool				output error if expected error is not in the error chain
 
 	ChkTru( bool, [fmt_args] ) bool
 		if test value is false, output check failed message (see below)
 		 returns TRUE on failure allowing this to be wrapped as part of 'if'
 
+	ChkEq( got, want, [fmt_args] ) bool
+		if got isn't deeply equal to want, output check failed message (see
+		 below) followed by a diff for strings ([-removed-] {+added+} or
+		 '- '/'+ ' lines) or got=/want= for other values
+		 returns TRUE if not equal allowing this to be wrapped as part of 'if'
+
+	ChkTruf( bool, fmtStr, [args...] ) bool
+	ChkErrf( error, fmtStr, [args...] ) bool
+		same as ChkTru / ChkErr but the message is always formatted
+
 	ChkErr( error, [fmt_args] ) bool
 		if error non-nil, output check failed message (see below)
 		 returns TRUE on non-nil allowing this to be wrapped as part of 'if'
 
+	WarnErr( error, [fmt_args] ) bool
+		same as ChkErr but output as a warning (Orange, 'WRN @ ...') for
+		 expected / recoverable errors
+
+	ChkErrS( error, [fmt_args] ) bool
+		same as ChkErr but also outputs the callers stack below the error
+		 (3 frames, see SetChkStackDepth( n ))
+
+	ChkErrR( error, [fmt_args] ) error
+		same as ChkErr but returns the error (nil if none) for propagation:
+		 if err := dbg.ChkErrR(e, "ctx"); nil != err { return err }
+
 	ChkErrI( error, []error, [fmt_args]) bool
 		if error non-nil, output check failed message (see below) as long
 		 as it's not in the ignore list of errors
 		 returns TRUE on non-nil allowing this to be wrapped as part of 'if'
 
 	ChkErrList( []error, [fmt_args]) bool
-		output check failed message (see below) if there are any non-nil
-		 values in the error list
+		output check failed message (see below) with its [index/count] for
+		 each non-nil value in the error list
 		 returns TRUE on non-nil allowing this to be wrapped as part of 'if'
 
+	ChkErrListE( []error, [fmt_args]) error
+		same as ChkErrList but returns the errors joined as a single error
+		 (nil if none) -- JoinErrs( []error ) error does just the joining
+
+	ErrSummary( error ) string
+		returns a one-line "outer: middle: inner" summary of the error chain
+
+	ErrorStack( error )
+		output the error with each error it wraps (& any stack frames of each)
+		 indented beneath it, each branch of errors.Join style errors listed
+
+	ChkSorted( slice, less, [fmt_args]) bool
+		output check failed message (see below) with the first out of order
+		 index if the slice isn't sorted per less(i, j) (as for sort.Slice)
+		 returns TRUE if unsorted allowing this to be wrapped as part of 'if'
+
+	ChkWithin( time.Duration, func(), [fmt_args]) bool
+		run the func, output check failed message (see below) if it took
+		 longer than the time budget to run
+		 returns TRUE on overrun allowing this to be wrapped as part of 'if'
+
 	ChkTru[PX]( bool, [chk_args] )
 		if test value is false, output check failed message (see below)
 		 then either Panic or force Exit -- See dbg.Panic below
@@ -68,35 +182,117 @@ import (
 		if error is non-nil, output check failed message (see below) then
 		 either Panic or force Exit -- See dbg.Panic below
 
+	Must( value, error ) value
+		returns the value if the error is nil, otherwise outputs the error
+		 with the callers location then PANICs with the error
+		 use as:  cfg := dbg.Must(LoadConfig(path))
+
+	-- Panic, PanicIf, PanicIfErr & ChkTruP / ChkErrP PANIC with a *PanicError
+	   holding the message, level & location of the call
+
 	Panic( [chk_args] )						output colored text then PANIC!
 	Fatal( [chk_args] )						output colored text then force exit
 	PanicIf( bool [, chk_args] )			PANIC only if true
 	FatalIf( bool [, chk_args] )			force exit if true
 	PanicIfErr( err [, chk_args] )			PANIC only if err is not nil
 	FatalIfErr( err [, chk_args] )			force exit if err is not nil
+	PanicWrapIfErr( err [, chk_args] )		PANIC if err is not nil, with err wrapped by the message
+	FatalWrapIfErr( err [, chk_args] )		force exit if err is not nil, with err wrapped by the message
 
 	TRC( [trc_args] )						output calling func file & line number
 											 followed by any arg data
 	Dbg.TRC()								conditional TRC based off of Dbg flag
+	DbgLvl.TRC( level [, trc_args] )		conditional TRC based off of DbgLvl level
+	DbgMsk.TRC( mask [, trc_args] )			conditional TRC based off of DbgMsk mask
+	TRCV( values... )						output calling func file & line number followed by
+											 'expr = value' of each value, expr read from the source
 	TRCIF( bool [, trc_args] )				conditional TRC based off of given bool
 	TRCFROM( [trc_args] )					output func calling func file & line number
 											 followed by any arg data
 	Dbg.TRCFROM()							conditional TRCFROM based off of Dbg flag
-
+	Group( name ) func()					output name then indent following output, returns func
+											 to undo the indent, use as:  defer dbg.Group("name")()
+	Indent() / Outdent()					indent / undo indenting following output lines
+	Trace( name ) func()					output '--> name' with calling location, returns
+											 func to output '<-- name (elapsed)'
+											 use as:  defer dbg.Trace("name")()
+	Dbg.Trace( name ) func()				conditional Trace based off of Dbg flag
+
+	FormatArgs( [error,] [fmt_args] ) string	returns message text of the args as used by the Chk funcs
 	IAm() string							returns callers func name
+	IAmFull() string						returns callers fully qualified func name
+	IWas() string							returns callers caller func name
+	Caller( skip ) string					returns func name skip frames up from the caller
 	ImAt() string							returns callers file & line number
 	WasAt() string							returns callers caller file & line number
 	ErrAt() (string, int)					returns callers file & line number
 	ErrWasAt() (string, int)				returns callers caller file & line number
+	Location( skip ) (file, line, func)		returns file, line & func name skip frames up from the caller
 
 	StackTrace()							output call stack (up to ten levels deep)
+	StackString() string					returns call stack (up to ten levels deep) as text
+	CaptureStack( depth, skip ) []Frame		returns the call stack frames for programmatic use
+	AllStacks()								output the stacks of all goroutines
+	EnableAutoStack( bool )					add the callers stack to all error output
+	SetAutoStackDepth( n )					most frames added by the auto stack (default 5)
+	DumpState()								output all goroutine stacks, mem stats & ring buffer
+	InstallDumpHandler( os.Signal )			DumpState() whenever the signal is received
+	UninstallDumpHandler()					remove the signal handler
+	Recover()								recover & output any panic with stack, use as:
+											 defer dbg.Recover()
+	CaptureRecover( recover() ) interface{}	output any recovered panic with stack, returning it
+
+	Size( label, value )					output len (& cap) of a slice, array, map, chan or string
+	Head( label, value, n )					output first n elements of a slice, array or map (sorted keys)
+	NonZero( label, value )					output value if it is not the zero value of its type
+	Checklist( map[string]bool )			output items sorted by name with a pass ✓ or fail ✗ mark
+	ChecklistOrdered( names, items )		output items in the order of names with a pass/fail mark
+	Tree( label, value )					output nested maps, slices & structs as a tree
+	StructJSON( label, value )				output struct fields named by their json tag names
+	DiffLines( a, b []string )				output a line diff, removed lines "- " (Red) & added "+ " (Green)
+	Rate( label, int64 )					output change & per second rate of a counter since last call
+	Count( name )							count an occurrence of the named event
+	DumpCounts()							output the totals of all counted events, sorted by name
+	ResetCounts()							clear the totals of all counted events
+	Start( label ) Timer					start a stopwatch, t.Lap( name ) outputs a split
+											 & t.Stop() outputs 'label took 1.23ms' (Gray)
+	RegisterEnum( type, map[int]string )	register names of an enum type's values
+	Enum( type, value ) string				returns value as type(NAME), e.g. State(RUNNING)
+
+	Capture() *Captured						capture all output in memory until Restore()
+											 for checking output in tests, has:
+											 String(), Lines() & Restore()
+	ToTestingT( TestLogger )				route output through the test's Logf until it ends (not per test)
+											 takes any testing.TB, e.g. a *testing.T or *testing.B
+	UseStdLog( *log.Logger )				route output through the logger (nil to restore)
+	SetOutput( io.Writer )					send all output to the writer (nil to restore)
+	WithWriter( io.Writer ) func()			send all output to the writer until the func is called:
+											 defer dbg.WithWriter(w)()
+	SetResilientOutput( dial )				send all output to a writer that is redialed on failure
+	SetStripColor( bool )					strip color from output, set by SetOutput if not a terminal
+	AddTee( io.Writer, strip bool )			also write all output to the writer (strip removes color)
+	RemoveTee( io.Writer )					stop writing output to the writer
+	ClearTees()								stop writing output to all added writers
+
+	Prompt( question ) string				output question & return the answer read from stdin, holding
+											 any other output until answered
+
+	NewBuffer() *Buffer						buffer output (b.Info(...), ...) until b.Flush() outputs it
+											 all together, b.FlushSorted() outputs most severe first
+
+	EnableRingBuffer( n )					keep the last n lines of output (uncolored) in memory
+	DumpRingBuffer( io.Writer )				write the kept lines out, oldest first
+	ClearRingBuffer()						clear the kept lines
 */
 
 type (
 	// Debug output that can work off of a simple bool flag
 	Dbg struct {
 		Enabled bool
-		MaxOut  int // maximum number of lines to output before doing system exit (0==unlimited)
+		MaxOut  int       // maximum number of lines to output before doing system exit (0==unlimited)
+		Prefix  string    // tag for this Dbg's output, shown as "[Prefix] " ("" for none)
+		Out     io.Writer // writer of this Dbg's output (nil for the normal output)
+		Err     io.Writer // writer of this Dbg's error output (nil for the normal error output)
 	}
 
 	// Debug output that can work off of an output level:
@@ -112,6 +308,24 @@ type (
 	DbgMsk struct {
 		Mask uint32
 	}
+
+	// Output level of the different text output functions, used to filter
+	//	output via SetMinLevel -- from least to most severe
+	Level int
+)
+
+const (
+	EchoLevel   Level = iota // Echo
+	StatLevel                // Status
+	NoteLevel                // Note
+	InfoLevel                // Info
+	MsgLevel                 // Message
+	WarnLevel                // Warning, WARNING
+	CcnLevel                 // Caution, CAUTION
+	FailLevel                // Failed, FAULT, ChkTru
+	ErrLevel                 // Error, ERROR, ChkErr, ExpErr
+	DangerLevel              // Danger
+	TrcLevel                 // TRC, TRCFROM, Trace -- filtered & ordered as EchoLevel
 )
 
 // dummy func to allow external use / non-use
@@ -124,36 +338,288 @@ func Link() {}
 
 // enable color output for debug text
 func Color() {
-	normColor = "\033[0m"         // reset to normal text
-	msgColor = "\033[36m"         // CYAN
-	infoColor = "\033[32m"        // GREEN
-	noteColor = "\033[34m"        // BLUE
-	warnColor = "\033[33m"        // ORANGE - YELLOW
-	ccnColor = "\033[93m"         // YELLOW - BRIGHT YELLOW
-	statColor = "\033[90m"        // GRAY
-	failColor = "\033[35m"        // MAGENTA
-	errColor = "\033[31m"         // RED
-	fatalColor = "\033[1;41m"     // WHITE on RED
-	blkCAUTION = "\033[1;30;103m" // BLACK on YELLOW
-	blkWARNING = "\033[30;43m"    // WHITE on ORANGE
-	blkFAULT = "\033[30;105m"     // WHITE on MAGENTA
+	changeColors(func(cs *colorSet) {
+		*cs = colorSet{
+			norm:       "\033[0m",        // reset to normal text
+			msg:        "\033[36m",       // CYAN
+			info:       "\033[32m",       // GREEN
+			note:       "\033[34m",       // BLUE
+			warn:       "\033[33m",       // ORANGE - YELLOW
+			ccn:        "\033[93m",       // YELLOW - BRIGHT YELLOW
+			stat:       "\033[90m",       // GRAY
+			fail:       "\033[35m",       // MAGENTA
+			err:        "\033[31m",       // RED
+			fatal:      "\033[1;41m",     // WHITE on RED
+			blkCAUTION: "\033[1;30;103m", // BLACK on YELLOW
+			blkWARNING: "\033[30;43m",    // WHITE on ORANGE
+			blkFAULT:   "\033[30;105m",   // WHITE on MAGENTA
+			on:         true,
+		}
+	})
 }
 
 // disable color output for debug text
 func NoColor() {
-	normColor = ""
-	msgColor = ""
-	infoColor = ""
-	noteColor = ""
-	warnColor = ""
-	ccnColor = ""
-	statColor = ""
-	failColor = ""
-	errColor = ""
-	fatalColor = ""
-	blkCAUTION = ""
-	blkWARNING = ""
-	blkFAULT = ""
+	changeColors(func(cs *colorSet) {
+		*cs = colorSet{}
+	})
+}
+
+// returns true if color output is enabled (Color() active), safe to call
+// while another goroutine calls Color() / NoColor()
+func ColorEnabled() bool {
+	return curColors().on
+}
+
+// set a 24-bit (truecolor) color for output at the given level, returns false
+// (leaving the 16 color set in use) if color is off or the terminal doesn't
+// claim truecolor support via $COLORTERM -- Color() restores the 16 color set
+func SetColorRGB(l Level, r, g, b uint8) bool {
+	if !ColorEnabled() || !truecolor() {
+		return false
+	}
+	changeColors(func(cs *colorSet) {
+		if cs.on {
+			cs.setLevel(l, fmt.Sprintf("\033[38;2;%d;%d;%dm", r, g, b))
+		}
+	})
+	return true
+}
+
+// output a line per level in its color, naming the func & its default color,
+// as a legend to check the terminal shows the colors (or any set by
+// SetColorRGB) as expected -- levels filtered by SetMinLevel are skipped
+func ColorTest() {
+	cs := curColors()
+	for _, c := range []struct {
+		l         Level
+		fn, color string
+	}{
+		{EchoLevel, "Echo", "normal"},
+		{StatLevel, "Status", "gray"},
+		{NoteLevel, "Note", "blue"},
+		{InfoLevel, "Info", "green"},
+		{MsgLevel, "Message", "cyan"},
+		{WarnLevel, "Warning", "orange"},
+		{CcnLevel, "Caution", "yellow"},
+		{FailLevel, "Failed", "magenta"},
+		{ErrLevel, "Error", "red"},
+		{DangerLevel, "Danger", "white on red"},
+	} {
+		if active(c.l) {
+			outlvl(c.l, "%s\n", cs.level(c.l)+fmt.Sprintf("%-8s (%s) the quick brown fox", c.fn, c.color)+cs.norm)
+		}
+	}
+	if !cs.on && active(EchoLevel) {
+		output(EchoLevel, "(color is off, see Color())\n")
+	}
+}
+
+// end each output with a newline (the default), turning it off allows building
+// a line from colored fragments, each still ending its color, that the
+// caller ends with a newline, e.g.
+//
+//	dbg.SetAutoNewline(false)
+//	dbg.Info("found: ")
+//	dbg.Error("%d errors", n)
+//	dbg.Echo("\n")
+//
+// the timestamp, prefix, ... are only added at the start of a line
+func SetAutoNewline(on bool) {
+	if on {
+		atomic.StoreInt32(&noNewline, 0)
+	} else {
+		atomic.StoreInt32(&noNewline, 1)
+	}
+}
+
+// set the separator between the location and the message of TRC/CHK/ERR
+// output, defaults to two spaces
+func SetLocationSeparator(sep string) {
+	changeConfig(func(c *settings) { c.locSep = sep })
+}
+
+// route all output at the given level to w instead of the normal output,
+// a nil w restores the normal output for the level
+func RouteLevel(l Level, w io.Writer) {
+	routeMu.Lock()
+	defer routeMu.Unlock()
+	if nil == w {
+		delete(routes, l)
+	} else {
+		routes[l] = w
+	}
+}
+
+// route output at the given level to w, returning a func that restores the
+// previous routing of the level
+//
+//	defer dbg.RouteLevelScoped(dbg.ErrLevel, w)()
+func RouteLevelScoped(l Level, w io.Writer) func() {
+	prev := routed(l)
+	RouteLevel(l, w)
+	return func() {
+		RouteLevel(l, prev)
+	}
+}
+
+// number each error line (Failed, Error, Danger & failed checks) as [#1],
+// [#2], ... so they can be referred to -- enabling restarts the count at 1
+func EnableErrorNumbers(on bool) {
+	if on {
+		atomic.StoreInt64(&errCount, 0)
+		atomic.StoreInt32(&errNums, 1)
+	} else {
+		atomic.StoreInt32(&errNums, 0)
+	}
+}
+
+// set the tags starting TRC, TRCFROM, CHK & ERR output, defaults are "TRC",
+// "WAS", "CHK" & "ERR" -- an empty tag drops the tag entirely, the tags of
+// other output (WRN, SIZ, VAL, ...) are left as they are
+func SetTags(trc, was, chk, err string) {
+	tag := func(t string) string {
+		if "" == t {
+			return ""
+		}
+		return t + " "
+	}
+	changeConfig(func(c *settings) {
+		c.tags[trcTag], c.tags[wasTag], c.tags[chkTag], c.tags[errTag] = tag(trc), tag(was), tag(chk), tag(err)
+	})
+}
+
+// set if the simple output funcs (Info, Error, ...) at all levels show the
+// callers location, overriding any SetLocationForLevel settings
+func SetShowCaller(show bool) {
+	bits := uint32(0)
+	if show {
+		bits = 1<<uint(DangerLevel+1) - 1
+	}
+	atomic.StoreUint32(&locLevels, bits)
+}
+
+// set if the simple output funcs (Info, Error, ...) at the given level show
+// the callers location, TRC/CHK output always shows its location
+func SetLocationForLevel(l Level, show bool) {
+	for {
+		old := atomic.LoadUint32(&locLevels)
+		bits := old &^ (1 << uint(l))
+		if show {
+			bits |= 1 << uint(l)
+		}
+		if atomic.CompareAndSwapUint32(&locLevels, old, bits) {
+			return
+		}
+	}
+}
+
+// set the clock used for timestamps & elapsed times (nil for time.Now), allows
+// a fixed or fake clock for deterministic output in tests
+func SetClock(clock func() time.Time) {
+	if nil == clock {
+		clock = time.Now
+	}
+	changeConfig(func(c *settings) { c.now = clock })
+}
+
+// start each line of output with a timestamp in the given time.Format layout,
+// "" (the default) for no timestamp
+func SetTimestamp(layout string) {
+	changeConfig(func(c *settings) { c.tsLayout = layout })
+}
+
+// start each line of output (after any timestamp) with the prefix, e.g. a
+// component name like "[auth]", "" (the default) for no prefix
+func SetPrefix(p string) {
+	changeConfig(func(c *settings) { c.prefix = p })
+}
+
+// start each line of output (after any timestamp) with the short host name,
+// as read from os.Hostname when enabled
+func EnableHostname(on bool) {
+	host := ""
+	if on {
+		host = shortHost()
+	}
+	changeConfig(func(c *settings) { c.hostname = host })
+}
+
+// returns the host name up to the first '.', or "unknown" if not available
+func shortHost() string {
+	h, err := os.Hostname()
+	if nil != err || "" == h {
+		return "unknown"
+	}
+	if n := strings.IndexByte(h, '.'); n > 0 {
+		h = h[:n]
+	}
+	return h
+}
+
+// set the func used to exit by the fatal funcs (nil for os.Exit), allows
+// testing Fatal, ChkTruX, ... without exiting
+func SetExitFunc(f func(int)) {
+	if nil == f {
+		f = os.Exit
+	}
+	changeConfig(func(c *settings) { c.exit = f })
+}
+
+// warn, with the callers location, whenever output shows a mismatch of the
+// format verbs & args (fmt's %!d(MISSING), %!(EXTRA ...), ...)
+func SetStrictFormat(on bool) {
+	if on {
+		atomic.StoreInt32(&strictFmt, 1)
+	} else {
+		atomic.StoreInt32(&strictFmt, 0)
+	}
+}
+
+// set the exit code used by the fatal funcs & Dbg.MaxOut countdown, defaults
+// to -1 (seen as 255 by most shells) -- CLIs are better off using 1 or 2
+func SetExitCode(code int) {
+	changeConfig(func(c *settings) { c.exitCode = code })
+}
+
+// set the minimum level of output, anything below the level is not output,
+// any level above EchoLevel also filters TRC output -- Fatal / Panic output
+// is never filtered
+func SetMinLevel(l Level) {
+	atomic.StoreInt32(&minLevel, int32(l))
+}
+
+// skip all output until Unsilence is called, unlike SetOutput(io.Discard) no
+// output is formatted so the calls left in the code cost next to nothing
+// -- Fatal / Panic output is never silenced
+func Silence() {
+	atomic.StoreInt32(&silenced, 1)
+}
+
+// undo Silence, output is once again formatted & output
+func Unsilence() {
+	atomic.StoreInt32(&silenced, 0)
+}
+
+// skip all output (as Silence) until the returned func is called, scopes may
+// nest with output resuming once all have ended -- Fatal / Panic output is
+// never skipped, use as:
+//
+//	defer dbg.Quiet()()
+func Quiet() func() {
+	atomic.AddInt32(&quiet, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { atomic.AddInt32(&quiet, -1) })
+	}
+}
+
+// run f only if output at the given level would currently be output, allows
+// skipping any expensive setup of debug only data
+func IfActive(l Level, f func()) {
+	if active(l) {
+		f()
+	}
 }
 
 // ------------------------------------------------------------------------- //
@@ -161,74 +627,168 @@ func NoColor() {
 
 // simply echo to output, no color hilites
 func Echo(fstr string, a ...interface{}) {
-	output(fstr+"\n", a...)
+	if active(EchoLevel) {
+		output(EchoLevel, locFor(EchoLevel)+fstr+"\n", a...)
+	}
 }
 
 // cyan text to output
 func Message(fstr string, a ...interface{}) {
-	output(msgColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if active(MsgLevel) {
+		output(MsgLevel, locFor(MsgLevel)+cs.msg+fstr+cs.norm+"\n", a...)
+	}
 }
 
 // green text to output
 func Info(fstr string, a ...interface{}) {
-	output(infoColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if active(InfoLevel) {
+		output(InfoLevel, locFor(InfoLevel)+cs.info+fstr+cs.norm+"\n", a...)
+	}
 }
 
 // blue text to output
 func Note(fstr string, a ...interface{}) {
-	output(noteColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if active(NoteLevel) {
+		output(NoteLevel, locFor(NoteLevel)+cs.note+fstr+cs.norm+"\n", a...)
+	}
 }
 
 // gray text to output
 func Status(fstr string, a ...interface{}) {
-	output(statColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if active(StatLevel) {
+		output(StatLevel, locFor(StatLevel)+cs.stat+fstr+cs.norm+"\n", a...)
+	}
 }
 
 // orange text to output
 func Warning(fstr string, a ...interface{}) {
-	output(warnColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if active(WarnLevel) {
+		output(WarnLevel, locFor(WarnLevel)+cs.warn+fstr+cs.norm+"\n", a...)
+	}
 }
 
 // yellow (bright orange) text to output
 func Caution(fstr string, a ...interface{}) {
-	output(ccnColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if active(CcnLevel) {
+		output(CcnLevel, locFor(CcnLevel)+cs.ccn+fstr+cs.norm+"\n", a...)
+	}
 }
 
 // magenta text to output
 func Failed(fstr string, a ...interface{}) {
-	outerr(failColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if active(FailLevel) {
+		outerr(FailLevel, locFor(FailLevel)+cs.fail+fstr+cs.norm+"\n", a...)
+	}
 }
 
 // red text to output
 func Error(fstr string, a ...interface{}) {
-	outerr(errColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if active(ErrLevel) {
+		outerr(ErrLevel, locFor(ErrLevel)+cs.err+fstr+cs.norm+"\n", a...)
+	}
 }
 
 // bold white on red background text to output
 func Danger(fstr string, a ...interface{}) {
-	output(fatalColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if active(DangerLevel) {
+		output(DangerLevel, locFor(DangerLevel)+cs.fatal+fstr+cs.norm+"\n", a...)
+	}
+}
+
+// set the writer that Persist output is also written to (nil to disable) so
+// important messages can survive a terminal clear, e.g. a log file
+func SetPersist(w io.Writer) {
+	changeConfig(func(c *settings) { c.persist = w })
+}
+
+// output text in the color of the given level, also writing the (uncolored)
+// text to any writer set by SetPersist
+func Persist(l Level, fstr string, a ...interface{}) {
+	cs := curColors()
+	if active(l) {
+		output(l, locFor(l)+cs.level(l)+fstr+cs.norm+"\n", a...)
+		if w := curConfig().persist; nil != w {
+			fmt.Fprintf(w, fstr+"\n", a...)
+		}
+	}
 }
 
 // white on orange text to output
 func WARNING(fstr string, a ...interface{}) {
-	output(blkWARNING+" WARNING "+normColor+" "+fstr+"\n", a...)
+	cs := curColors()
+	if active(WarnLevel) {
+		output(WarnLevel, locFor(WarnLevel)+cs.blkWARNING+" WARNING "+cs.norm+" "+fstr+"\n", a...)
+	}
 }
 
 // black on yellow (bright orange) text to output
 func CAUTION(fstr string, a ...interface{}) {
-	output(blkCAUTION+" CAUTION "+normColor+" "+fstr+"\n", a...)
+	cs := curColors()
+	if active(CcnLevel) {
+		output(CcnLevel, locFor(CcnLevel)+cs.blkCAUTION+" CAUTION "+cs.norm+" "+fstr+"\n", a...)
+	}
 }
 
 // red text to output
 func ERROR(fstr string, a ...interface{}) {
-	output(fatalColor+"  ERROR  "+normColor+" "+fstr+"\n", a...)
+	cs := curColors()
+	if active(ErrLevel) {
+		output(ErrLevel, locFor(ErrLevel)+cs.fatal+"  ERROR  "+cs.norm+" "+fstr+"\n", a...)
+	}
 }
 
 // red text to output
 func FAULT(fstr string, a ...interface{}) {
-	output(blkFAULT+"  FAULT  "+normColor+" "+fstr+"\n", a...)
+	cs := curColors()
+	if active(FailLevel) {
+		output(FailLevel, locFor(FailLevel)+cs.blkFAULT+"  FAULT  "+cs.norm+" "+fstr+"\n", a...)
+	}
+}
+
+// output the label as a badge (black on cyan unless set by SetBadgeColor)
+// followed by the text, like WARNING, e.g. Badge("DEPLOY", "to %s", host)
+func Badge(label, fstr string, a ...interface{}) {
+	cs := curColors()
+	if active(MsgLevel) {
+		output(MsgLevel, locFor(MsgLevel)+badgeColor(cs, label)+" "+strings.ReplaceAll(label, "%", "%%")+" "+cs.norm+" "+fstr+"\n", a...)
+	}
+}
+
+// set the color of the label's Badge by its SGR parameters, e.g. "30;42" for
+// black on green -- "" restores the default of black on cyan
+func SetBadgeColor(label, sgr string) {
+	badgeMu.Lock()
+	defer badgeMu.Unlock()
+	if "" == sgr {
+		delete(badges, label)
+	} else {
+		badges[label] = sgr
+	}
 }
 
+// returns the color of the label's badge, "" if color is off
+func badgeColor(cs *colorSet, label string) string {
+	if !cs.on {
+		return ""
+	}
+	badgeMu.Lock()
+	defer badgeMu.Unlock()
+	if sgr, ok := badges[label]; ok {
+		return "\033[" + sgr + "m"
+	}
+	return "\033[30;46m" // BLACK on CYAN
+}
+
+// PANIC if any value is nil -- including a typed nil (see isNil)
 func MustHaveP(a ...interface{}) { // (tst1, tst2, tst3, "missing tst" | error)
 	msg := "Missing value"
 	if len(a) > 1 { // pull last interface off and see if a msg 'string' or error
@@ -241,12 +801,14 @@ func MustHaveP(a ...interface{}) { // (tst1, tst2, tst3, "missing tst" | error)
 		}
 	}
 	for _, t := range a {
-		if t == nil {
-			panic(errors.New(failed(false, msg)))
+		if isNil(t) {
+			Flush()
+			panic(panicked(FailLevel, failed(false, msg)))
 		}
 	}
 }
 
+// returns an error if any value is nil -- including a typed nil (see isNil)
 func MustHave(a ...interface{}) error { // (tst1, tst2, tst3, "missing tst" | error)
 	err := errors.New("Missing value")
 	if len(a) > 1 { // pull last interface off and see if a msg 'string' or error
@@ -259,136 +821,474 @@ func MustHave(a ...interface{}) error { // (tst1, tst2, tst3, "missing tst" | er
 		}
 	}
 	for _, t := range a {
-		if t == nil {
+		if isNil(t) {
 			return err
 		}
 	}
 	return nil
 }
 
+// returns the index of the first nil value (-1 if none, see isNil), so a long list of
+// values can be checked with a message naming the missing one -- as with
+// MustHave any trailing msg 'string' or error is not one of the values
+func MustHaveAt(a ...interface{}) int { // (tst1, tst2, tst3, "missing tst" | error)
+	if len(a) > 1 { // pull last interface off if a msg 'string' or error
+		switch a[len(a)-1].(type) {
+		case string, error:
+			a = a[:len(a)-1]
+		}
+	}
+	for n, t := range a {
+		if isNil(t) {
+			return n
+		}
+	}
+	return -1
+}
+
+// returns true if v is nil, or is a "typed nil": an interface holding a nil
+// pointer, map, slice, chan or func -- v == nil is false for these as the
+// interface still has a type, a frequent source of bugs:
+//
+//	var p *Config            // nil
+//	var v interface{} = p    // v != nil, but isNil(v)
+func isNil(v interface{}) bool {
+	if nil == v {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return rv.IsNil()
+	}
+	return false
+}
+
 // ------------------------------------------------------------------------- //
 // These functions do not allow the 'closer' func as they always return a bool
 
 // output err message if expected error not matched
 func ExpErr(e, x error) bool {
-	if e != x {
-		outerr("%s\n", errColor+"ERR "+at()+normColor+errored(false, e, "Expected error (%v) not given", x))
+	cs := curColors()
+	if e != x && active(ErrLevel) {
+		outerr(ErrLevel, "%s\n", tagged(cs, cs.err, errTag, at())+errored(false, e, "Expected error (%v) not given", x))
 	}
 	return (e != x)
 }
 
+// output err message if expected error not in the error chain (errors.Is), so
+// an expected sentinel error may be wrapped with context
+func ExpErrIs(e, target error) bool {
+	cs := curColors()
+	miss := !errors.Is(e, target)
+	if miss && active(ErrLevel) {
+		outerr(ErrLevel, "%s\n", tagged(cs, cs.err, errTag, at())+errored(false, e, "Expected error (%v) not in error chain (%v)", target, e))
+	}
+	return miss
+}
+
+// output err message, showing how they differ, if got isn't deeply equal to
+// want -- strings are shown as a diff
+func ChkEq(got, want interface{}, a ...interface{}) bool {
+	cs := curColors()
+	ne := !reflect.DeepEqual(got, want)
+	if ne && active(FailLevel) {
+		msg := "Not equal"
+		if len(a) > 0 {
+			msg = failed(false, a...)
+		}
+		outerr(FailLevel, "%s\n%s", tagged(cs, cs.fail, chkTag, at())+msg, eqDiff(got, want))
+	}
+	return ne
+}
+
 // output err message if test not true
 func ChkTru(tst bool, a ...interface{}) bool {
-	if !tst {
-		outerr("%s\n", failColor+"CHK "+at()+normColor+failed(false, a...))
+	cs := curColors()
+	if !tst && active(FailLevel) {
+		outerr(FailLevel, "%s\n", tagged(cs, cs.fail, chkTag, at())+failed(false, a...))
 	}
 	return !tst
 }
 
+// output formatted err message if test not true
+func ChkTruf(tst bool, fstr string, a ...interface{}) bool {
+	if !tst && active(FailLevel) {
+		cs := curColors()
+		outerr(FailLevel, "%s\n", tagged(cs, cs.fail, chkTag, at())+fmt.Sprintf(fstr, a...))
+	}
+	return !tst
+}
+
+// output formatted err message if given error isn't nil - returns testable boolean
+func ChkErrf(e error, fstr string, a ...interface{}) bool {
+	if nil != e && active(ErrLevel) {
+		cs := curColors()
+		outerr(ErrLevel, "%s\n", tagged(cs, cs.err, errTag, at())+fmt.Sprintf(fstr, a...))
+	}
+	return (nil != e)
+}
+
 // output err message if given error isn't nil - returns testable boolean
 func ChkErr(e error, a ...interface{}) bool {
-	if nil != e {
-		outerr("%s\n", errColor+"ERR "+at()+normColor+errored(false, e, a...))
+	cs := curColors()
+	if nil != e && active(ErrLevel) {
+		outerr(ErrLevel, "%s\n", tagged(cs, cs.err, errTag, at())+errored(false, e, a...))
 	}
 	return (nil != e)
 }
 
+// output warning message if given error isn't nil, for expected errors that
+// are still worth noting - returns testable boolean as ChkErr
+func WarnErr(e error, a ...interface{}) bool {
+	cs := curColors()
+	if nil != e && active(WarnLevel) {
+		output(WarnLevel, "%s\n", tagged(cs, cs.warn, wrnTag, at())+errored(false, e, a...))
+	}
+	return (nil != e)
+}
+
+// output err message followed by the callers stack (see SetChkStackDepth) if
+// given error isn't nil - returns testable boolean
+func ChkErrS(e error, a ...interface{}) bool {
+	cs := curColors()
+	if nil != e && active(ErrLevel) {
+		stk := ""
+		if 0 == atomic.LoadInt32(&autoStack) { // else the stack is added anyway
+			for _, f := range CaptureStack(int(atomic.LoadInt32(&chkDepth)), 1) {
+				stk += cs.err + "  " + f.String() + cs.norm + "\n"
+			}
+		}
+		outerr(ErrLevel, "%s\n%s", tagged(cs, cs.err, errTag, at())+errored(false, e, a...), stk)
+	}
+	return (nil != e)
+}
+
+// output err message if given error isn't nil - returns the error for propagation
+func ChkErrR(e error, a ...interface{}) error {
+	cs := curColors()
+	if nil != e && active(ErrLevel) {
+		outerr(ErrLevel, "%s\n", tagged(cs, cs.err, errTag, at())+errored(false, e, a...))
+	}
+	return e
+}
+
 // output err message if error, but ignore (don't output) any in the 'i' slice
 func ChkErrI(e error, i []error, a ...interface{}) bool {
-	if nil != e {
+	cs := curColors()
+	if nil != e && active(ErrLevel) {
 		for _, t := range i {
 			if t == e {
 				return true // error still occured, just not reported
 			}
 		}
-		outerr("%s\n", errColor+"ERR "+at()+normColor+errored(false, e, a...))
+		outerr(ErrLevel, "%s\n", tagged(cs, cs.err, errTag, at())+errored(false, e, a...))
 	}
 	return (nil != e)
 }
 
 // output err message if there are any errors in the given list
 func ChkErrList(errs []error, a ...interface{}) bool {
+	cs := curColors()
 	failed := false
-	for _, e := range errs {
+	for n, e := range errs {
 		if nil != e {
-			outerr("%s\n", errColor+"ERR "+at()+normColor+errored(false, e, a...))
+			if active(ErrLevel) {
+				outerr(ErrLevel, "%s[%d/%d] %s\n", tagged(cs, cs.err, errTag, at()), n+1, len(errs), errored(false, e, a...))
+			}
 			failed = true
 		}
 	}
 	return failed
 }
 
+// output err message for each error in the given list, returning them joined
+// into a single error (nil if there are none) for passing back up
+func ChkErrListE(errs []error, a ...interface{}) error {
+	cs := curColors()
+	for n, e := range errs {
+		if nil != e && active(ErrLevel) {
+			outerr(ErrLevel, "%s[%d/%d] %s\n", tagged(cs, cs.err, errTag, at()), n+1, len(errs), errored(false, e, a...))
+		}
+	}
+	return JoinErrs(errs)
+}
+
+// returns the non-nil errors of the list joined into a single error (in order),
+// or nil if there are none
+func JoinErrs(errs []error) error {
+	return errors.Join(errs...)
+}
+
+// returns a one-line summary of an error chain, e.g. "outer: middle: inner",
+// joining each layer's own message (without the text of the error it wraps)
+func ErrSummary(e error) string {
+	if nil == e {
+		return ""
+	}
+	var msgs []string
+	for ; nil != e; e = errors.Unwrap(e) {
+		msg := e.Error()
+		if in := errors.Unwrap(e); nil != in && strings.HasSuffix(msg, in.Error()) {
+			msg = strings.TrimRight(strings.TrimSuffix(msg, in.Error()), ": ")
+		}
+		if "" != msg {
+			msgs = append(msgs, msg)
+		}
+	}
+	return strings.Join(msgs, ": ")
+}
+
+// output the error (red) and, indented beneath it, each error it wraps, listing
+// each branch of an error wrapping several (errors.Join) -- along with the
+// frames of any layer having a StackTrace method, a plain error is output
+// as Error would
+func ErrorStack(e error) {
+	if nil == e || !active(ErrLevel) {
+		return
+	}
+	cs := curColors()
+	var b strings.Builder
+	errLayer(&b, cs, e, "")
+	outlvl(ErrLevel, "%s", locFor(ErrLevel)+b.String())
+}
+
+// add the error's own message, any of its frames & then the errors it wraps
+// to the text, each line indented by ind
+func errLayer(b *strings.Builder, cs *colorSet, e error, ind string) {
+	ins := unwrapAll(e)
+	msg := ownMsg(e, ins)
+	if "" == msg {
+		msg = fmt.Sprintf("(%d errors)", len(ins))
+	}
+	b.WriteString(ind + cs.err + strings.ReplaceAll(msg, "\n", "; ") + cs.norm + "\n")
+	for _, f := range errFrames(e) {
+		b.WriteString(ind + "  " + cs.stat + f + cs.norm + "\n")
+	}
+	for _, in := range ins {
+		errLayer(b, cs, in, ind+"    ")
+	}
+}
+
+// returns the errors e wraps, more than one if it wraps several
+func unwrapAll(e error) []error {
+	switch u := e.(type) {
+	case interface{ Unwrap() []error }:
+		return u.Unwrap()
+	case interface{ Unwrap() error }:
+		if in := u.Unwrap(); nil != in {
+			return []error{in}
+		}
+	}
+	return nil
+}
+
+// returns the message of e without the text of the errors it wraps
+func ownMsg(e error, ins []error) string {
+	msg := e.Error()
+	var txt []string
+	for _, in := range ins {
+		txt = append(txt, in.Error())
+	}
+	if all := strings.Join(txt, "\n"); "" != all && strings.HasSuffix(msg, all) {
+		msg = strings.TrimRight(strings.TrimSuffix(msg, all), ": \n")
+	}
+	return msg
+}
+
+// returns the frames of an error with a StackTrace method returning a slice
+// (as github.com/pkg/errors has), a line per frame
+func errFrames(e error) []string {
+	m := reflect.ValueOf(e).MethodByName("StackTrace")
+	if !m.IsValid() || 0 != m.Type().NumIn() || 1 != m.Type().NumOut() {
+		return nil
+	}
+	v := m.Call(nil)[0]
+	if reflect.Slice != v.Kind() {
+		return nil
+	}
+	var fs []string
+	for n := 0; n < v.Len(); n++ {
+		f := fmt.Sprintf("%+v", v.Index(n).Interface())
+		fs = append(fs, strings.ReplaceAll(strings.ReplaceAll(f, "\n\t", " "), "\n", " "))
+	}
+	return fs
+}
+
+// output err message with the first out of order index if the slice isn't
+// sorted per less (as for sort.Slice)
+func ChkSorted(v interface{}, less func(i, j int) bool, a ...interface{}) bool {
+	cs := curColors()
+	n := reflect.ValueOf(v).Len()
+	for i := 1; i < n; i++ {
+		if less(i, i-1) {
+			if active(FailLevel) {
+				msg := "Not sorted"
+				if len(a) > 0 {
+					msg = failed(false, a...)
+				}
+				outerr(FailLevel, "%s (index %d out of order)\n", tagged(cs, cs.fail, chkTag, at())+msg, i)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// output err message if f takes longer than the budget to run
+func ChkWithin(budget time.Duration, f func(), a ...interface{}) bool {
+	cs := curColors()
+	start := now()
+	f()
+	took := now().Sub(start)
+	if took > budget && active(FailLevel) {
+		msg := "Time budget exceeded"
+		if len(a) > 0 {
+			msg = failed(false, a...)
+		}
+		outerr(FailLevel, "%s (took %v, budget %v)\n", tagged(cs, cs.fail, chkTag, at())+msg, took, budget)
+	}
+	return took > budget
+}
+
+// The value the panic funcs (Panic, PanicIf, ChkTruP, ...) panic with, so
+// recovering code can inspect where & why -- its Error() is the message
+type PanicError struct {
+	Msg   string // message as given by the chk_args
+	Level Level  // FailLevel for failed checks, ErrLevel for errors, else DangerLevel
+	File  string // location of the call of the panic func
+	Line  int
+	Func  string
+}
+
+func (p *PanicError) Error() string {
+	return p.Msg
+}
+
+// returns the value to panic with, located at the caller of the panic func
+func panicked(l Level, msg string) *PanicError {
+	file, line, fn := Location(2)
+	return &PanicError{msg, l, file, line, fn}
+}
+
 // ------------------------------------------------------------------------- //
 // These functions can work with a 'closer'
 
 // output err message if test not true, then PANIC
 func ChkTruP(tst bool, a ...interface{}) {
 	if !tst {
-		panic(errors.New(failed(true, a...)))
+		Flush()
+		panic(panicked(FailLevel, failed(true, a...)))
 	}
 }
 
 // output err message if test not true, then EXIT
 func ChkTruX(tst bool, a ...interface{}) {
+	cs := curColors()
 	if !tst {
-		outerr("%s\n", failColor+"CHK "+at()+normColor+failed(true, a...))
-		os.Exit(-1)
+		outerr(DangerLevel, "%s\n", tagged(cs, cs.fail, chkTag, at())+failed(true, a...))
+		Flush()
+		exit()
 	}
 }
 
 // output err message and PANIC if given error isn't nil
 func ChkErrP(e error, a ...interface{}) {
 	if nil != e {
-		panic(errors.New(errored(true, e, a...)))
+		Flush()
+		panic(panicked(ErrLevel, errored(true, e, a...)))
+	}
+}
+
+// returns v if the error is nil, otherwise outputs the error (with the callers
+// location) then PANICs with it -- for the (value, error) results of setup:
+//
+//	cfg := dbg.Must(LoadConfig(path))
+func Must[T any](v T, e error) T {
+	if nil != e {
+		cs := curColors()
+		outerr(DangerLevel, "%s\n", tagged(cs, cs.err, errTag, at())+e.Error())
+		Flush()
+		panic(e)
 	}
+	return v
 }
 
 // output err message and EXIT if given error isn't nil
 func ChkErrX(e error, a ...interface{}) {
+	cs := curColors()
 	if nil != e {
-		outerr("%s\n", errColor+"ERR "+at()+normColor+errored(true, e, a...))
-		os.Exit(-1)
+		outerr(DangerLevel, "%s\n", tagged(cs, cs.err, errTag, at())+errored(true, e, a...))
+		Flush()
+		exit()
 	}
 }
 
 // panic with any optional chk_args
 func Panic(a ...interface{}) {
-	panic(errors.New(failed(true, a...)))
+	Flush()
+	panic(panicked(DangerLevel, failed(true, a...)))
 }
 
 // fatal error (exit) with any optional chk_args
 func Fatal(a ...interface{}) {
-	outerr("%s\n", fatalColor+failed(true, a...)+normColor)
-	os.Exit(-1)
+	cs := curColors()
+	outerr(DangerLevel, "%s\n", cs.fatal+failed(true, a...)+cs.norm)
+	Flush()
+	exit()
 }
 
 // conditional panic
 func PanicIf(b bool, a ...interface{}) {
 	if b {
-		panic(errors.New(failed(true, a...)))
+		Flush()
+		panic(panicked(DangerLevel, failed(true, a...)))
 	}
 }
 
 // conditional fatal
 func FatalIf(b bool, a ...interface{}) {
+	cs := curColors()
 	if b {
-		outerr("%s\n", fatalColor+failed(true, a...)+normColor)
-		os.Exit(-1)
+		outerr(DangerLevel, "%s\n", cs.fatal+failed(true, a...)+cs.norm)
+		Flush()
+		exit()
 	}
 }
 
 // conditional panic
 func PanicIfErr(e error, a ...interface{}) {
 	if nil != e {
-		panic(errors.New(errored(true, e, a...)))
+		Flush()
+		panic(panicked(ErrLevel, errored(true, e, a...)))
 	}
 }
 
 // conditional fatal
 func FatalIfErr(e error, a ...interface{}) {
+	cs := curColors()
+	if nil != e {
+		outerr(DangerLevel, "%s\n", cs.fatal+errored(true, e, a...)+cs.norm)
+		Flush()
+		exit()
+	}
+}
+
+// conditional panic, wrapping the error with any chk_args message as a prefix
+// so errors.Is / errors.As still work on the recovered value
+func PanicWrapIfErr(e error, a ...interface{}) {
 	if nil != e {
-		outerr("%s\n", fatalColor+errored(true, e, a...)+normColor)
-		os.Exit(-1)
+		Flush()
+		panic(wrapped(e, a...))
+	}
+}
+
+// conditional fatal, wrapping the error with any chk_args message as a prefix
+func FatalWrapIfErr(e error, a ...interface{}) {
+	cs := curColors()
+	if nil != e {
+		outerr(DangerLevel, "%s\n", cs.fatal+wrapped(e, a...).Error()+cs.norm)
+		Flush()
+		exit()
 	}
 }
 
@@ -396,88 +1296,98 @@ func FatalIfErr(e error, a ...interface{}) {
 
 // simply echo to output, no color hilites
 func (d *Dbg) Echo(fstr string, a ...interface{}) {
-	if d.Enabled {
-		output(fstr+"\n", a...)
+	if d.Enabled && active(EchoLevel) {
+		d.output(EchoLevel, d.tag()+locFor(EchoLevel)+fstr+"\n", a...)
 		d.decExit()
 	}
 }
 
 // cyan text to output
 func (d *Dbg) Message(fstr string, a ...interface{}) {
-	if d.Enabled {
-		output(msgColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Enabled && active(MsgLevel) {
+		d.output(MsgLevel, d.tag()+locFor(MsgLevel)+cs.msg+fstr+cs.norm+"\n", a...)
 		d.decExit()
 	}
 }
 
 // green text to output
 func (d *Dbg) Info(fstr string, a ...interface{}) {
-	if d.Enabled {
-		output(infoColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Enabled && active(InfoLevel) {
+		d.output(InfoLevel, d.tag()+locFor(InfoLevel)+cs.info+fstr+cs.norm+"\n", a...)
 		d.decExit()
 	}
 }
 
 // blue text to output
 func (d *Dbg) Note(fstr string, a ...interface{}) {
-	if d.Enabled {
-		output(noteColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Enabled && active(NoteLevel) {
+		d.output(NoteLevel, d.tag()+locFor(NoteLevel)+cs.note+fstr+cs.norm+"\n", a...)
 		d.decExit()
 	}
 }
 
 // gray text to output
 func (d *Dbg) Status(fstr string, a ...interface{}) {
-	if d.Enabled {
-		output(statColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Enabled && active(StatLevel) {
+		d.output(StatLevel, d.tag()+locFor(StatLevel)+cs.stat+fstr+cs.norm+"\n", a...)
 		d.decExit()
 	}
 }
 
 // orange text to output
 func (d *Dbg) Warning(fstr string, a ...interface{}) {
-	if d.Enabled {
-		output(warnColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Enabled && active(WarnLevel) {
+		d.output(WarnLevel, d.tag()+locFor(WarnLevel)+cs.warn+fstr+cs.norm+"\n", a...)
 		d.decExit()
 	}
 }
 
 // yellow (bright orange) text to output
 func (d *Dbg) Caution(fstr string, a ...interface{}) {
-	if d.Enabled {
-		output(ccnColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Enabled && active(CcnLevel) {
+		d.output(CcnLevel, d.tag()+locFor(CcnLevel)+cs.ccn+fstr+cs.norm+"\n", a...)
 		d.decExit()
 	}
 }
 
 // magenta text to output
 func (d *Dbg) Failed(fstr string, a ...interface{}) {
-	if d.Enabled {
-		outerr(failColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Enabled && active(FailLevel) {
+		d.outerr(FailLevel, d.tag()+locFor(FailLevel)+cs.fail+fstr+cs.norm+"\n", a...)
 		d.decExit()
 	}
 }
 
 // red text to output
 func (d *Dbg) Error(fstr string, a ...interface{}) {
-	if d.Enabled {
-		outerr(errColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Enabled && active(ErrLevel) {
+		d.outerr(ErrLevel, d.tag()+locFor(ErrLevel)+cs.err+fstr+cs.norm+"\n", a...)
 		d.decExit()
 	}
 }
 
 // bold white on red background text to output
 func (d *Dbg) Danger(fstr string, a ...interface{}) {
-	if d.Enabled {
-		output(fatalColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Enabled && active(DangerLevel) {
+		d.output(DangerLevel, d.tag()+locFor(DangerLevel)+cs.fatal+fstr+cs.norm+"\n", a...)
 		d.decExit()
 	}
 }
 
 // output err message if test not true
 func (d *Dbg) ChkTru(tst bool, a ...interface{}) bool {
-	if d.Enabled && !tst {
-		outerr("%s\n", failColor+"CHK "+at()+normColor+failed(false, a...))
+	cs := curColors()
+	if d.Enabled && !tst && active(FailLevel) {
+		d.outerr(FailLevel, d.tag()+"%s\n", tagged(cs, cs.fail, chkTag, at())+failed(false, a...))
 		d.decExit()
 	}
 	return !tst
@@ -485,8 +1395,19 @@ func (d *Dbg) ChkTru(tst bool, a ...interface{}) bool {
 
 // output err message if given error isn't nil - returns testable boolean
 func (d *Dbg) ChkErr(e error, a ...interface{}) bool {
-	if d.Enabled && nil != e {
-		outerr("%s\n", errColor+"ERR "+at()+normColor+errored(false, e, a...))
+	cs := curColors()
+	if d.Enabled && nil != e && active(ErrLevel) {
+		d.outerr(ErrLevel, d.tag()+"%s\n", tagged(cs, cs.err, errTag, at())+errored(false, e, a...))
+		d.decExit()
+	}
+	return (nil != e)
+}
+
+// output warning message if given error isn't nil - returns testable boolean
+func (d *Dbg) WarnErr(e error, a ...interface{}) bool {
+	cs := curColors()
+	if d.Enabled && nil != e && active(WarnLevel) {
+		d.output(WarnLevel, d.tag()+"%s\n", tagged(cs, cs.warn, wrnTag, at())+errored(false, e, a...))
 		d.decExit()
 	}
 	return (nil != e)
@@ -494,24 +1415,69 @@ func (d *Dbg) ChkErr(e error, a ...interface{}) bool {
 
 // output err message if error, but ignore (don't output) any in the 'i' slice
 func (d *Dbg) ChkErrI(e error, i []error, a ...interface{}) bool {
-	if d.Enabled && nil != e {
+	cs := curColors()
+	if d.Enabled && nil != e && active(ErrLevel) {
 		for _, t := range i {
 			if t == e {
 				return true // error still occured, just not reported
 			}
 		}
-		outerr("%s\n", errColor+"ERR "+at()+normColor+errored(false, e, a...))
+		d.outerr(ErrLevel, d.tag()+"%s\n", tagged(cs, cs.err, errTag, at())+errored(false, e, a...))
 	}
 	return (nil != e)
 }
 
+// reset the number of lines to output before doing system exit (0==unlimited)
+func (d *Dbg) ResetMaxOut(n int) {
+	maxOutMu.Lock()
+	d.MaxOut = n
+	maxOutMu.Unlock()
+}
+
+// returns the Prefix tag to start an output format string, with any '%' escaped
+func (d *Dbg) tag() string {
+	if "" == d.Prefix {
+		return ""
+	}
+	return "[" + strings.ReplaceAll(d.Prefix, "%", "%%") + "] "
+}
+
+// output text at the given level to the Dbg's Out writer, or the normal
+// output if none
+func (d *Dbg) output(l Level, f string, a ...interface{}) {
+	emitTo(l, curConfig().outSink, d.Out, fmt.Sprintf(f, a...))
+}
+
+// output text at the given level, started with the Dbg's tag, to its Out
+// writer or the normal output if none
+func (d *Dbg) tagOutput(l Level, f string, a ...interface{}) {
+	d.output(l, d.tag()+f, a...)
+}
+
+// output text at the given level to the Dbg's Err writer, or the normal
+// error output if none
+func (d *Dbg) outerr(l Level, f string, a ...interface{}) {
+	emitTo(l, curConfig().errSink, d.Err, fmt.Sprintf(f, a...))
+}
+
+// count down MaxOut, exiting once it expires -- safe for concurrent use
 func (d *Dbg) decExit() {
+	maxOutMu.Lock()
+	expired := false
 	if d.MaxOut > 0 {
 		d.MaxOut -= 1
-		if 0 == d.MaxOut {
-			Error("--Countdown expired %s", funcAt(2))
-			os.Exit(-1)
+		expired = 0 == d.MaxOut
+	}
+	maxOutMu.Unlock()
+	if expired {
+		if active(ErrLevel) {
+			cs := curColors()
+			d.outerr(ErrLevel, d.tag()+locFor(ErrLevel)+cs.err+"--Countdown expired %s"+cs.norm+"\n", funcAt(2))
 		}
+		Flush()
+		flushWriter(d.Out)
+		flushWriter(d.Err)
+		exit()
 	}
 }
 
@@ -519,86 +1485,97 @@ func (d *Dbg) decExit() {
 
 // simply echo to output, no color hilites
 func (d DbgLvl) Echo(l int, fstr string, a ...interface{}) {
-	if d.Level > 0 && d.Level >= l {
-		output(fstr+"\n", a...)
+	if d.Level > 0 && d.Level >= l && active(EchoLevel) {
+		output(EchoLevel, locFor(EchoLevel)+fstr+"\n", a...)
 	}
 }
 
 // cyan text to output
 func (d DbgLvl) Message(l int, fstr string, a ...interface{}) {
-	if d.Level > 0 && d.Level >= l {
-		output(msgColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && active(MsgLevel) {
+		output(MsgLevel, locFor(MsgLevel)+cs.msg+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // green text to output
 func (d DbgLvl) Info(l int, fstr string, a ...interface{}) {
-	if d.Level > 0 && d.Level >= l {
-		output(infoColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && active(InfoLevel) {
+		output(InfoLevel, locFor(InfoLevel)+cs.info+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // blue text to output
 func (d DbgLvl) Note(l int, fstr string, a ...interface{}) {
-	if d.Level > 0 && d.Level >= l {
-		output(noteColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && active(NoteLevel) {
+		output(NoteLevel, locFor(NoteLevel)+cs.note+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // stat text to output
 func (d DbgLvl) Status(l int, fstr string, a ...interface{}) {
-	if d.Level > 0 && d.Level >= l {
-		output(statColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && active(StatLevel) {
+		output(StatLevel, locFor(StatLevel)+cs.stat+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // orange text to output
 func (d DbgLvl) Warning(l int, fstr string, a ...interface{}) {
-	if d.Level > 0 && d.Level >= l {
-		output(warnColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && active(WarnLevel) {
+		output(WarnLevel, locFor(WarnLevel)+cs.warn+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // yellow (bright orange) text to output
 func (d DbgLvl) Caution(l int, fstr string, a ...interface{}) {
-	if d.Level > 0 && d.Level >= l {
-		output(ccnColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && active(CcnLevel) {
+		output(CcnLevel, locFor(CcnLevel)+cs.ccn+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // magenta text to output
 func (d DbgLvl) Failed(l int, fstr string, a ...interface{}) {
-	if d.Level > 0 && d.Level >= l {
-		outerr(failColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && active(FailLevel) {
+		outerr(FailLevel, locFor(FailLevel)+cs.fail+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // red text to output
 func (d DbgLvl) Error(l int, fstr string, a ...interface{}) {
-	if d.Level > 0 && d.Level >= l {
-		outerr(errColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && active(ErrLevel) {
+		outerr(ErrLevel, locFor(ErrLevel)+cs.err+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // bold white on red background text to output
 func (d DbgLvl) Danger(l int, fstr string, a ...interface{}) {
-	if d.Level > 0 && d.Level >= l {
-		output(fatalColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && active(DangerLevel) {
+		output(DangerLevel, locFor(DangerLevel)+cs.fatal+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // output err message if test not true
 func (d DbgLvl) ChkTru(l int, tst bool, a ...interface{}) bool {
-	if d.Level > 0 && d.Level >= l && !tst {
-		outerr("%s\n", failColor+"CHK "+at()+normColor+failed(false, a...))
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && !tst && active(FailLevel) {
+		outerr(FailLevel, "%s\n", tagged(cs, cs.fail, chkTag, at())+failed(false, a...))
 	}
 	return !tst
 }
 
 // output err message if given error isn't nil - returns testable boolean
 func (d DbgLvl) ChkErr(l int, e error, a ...interface{}) bool {
-	if d.Level > 0 && d.Level >= l && nil != e {
-		outerr("%s\n", errColor+"ERR "+at()+normColor+errored(false, e, a...))
+	cs := curColors()
+	if d.Level > 0 && d.Level >= l && nil != e && active(ErrLevel) {
+		outerr(ErrLevel, "%s\n", tagged(cs, cs.err, errTag, at())+errored(false, e, a...))
 	}
 	return (nil != e)
 }
@@ -607,86 +1584,97 @@ func (d DbgLvl) ChkErr(l int, e error, a ...interface{}) bool {
 
 // simply echo to output, no color hilites
 func (d DbgMsk) Echo(m uint32, fstr string, a ...interface{}) {
-	if 0 != d.Mask&m {
-		output(fstr+"\n", a...)
+	if 0 != d.Mask&m && active(EchoLevel) {
+		output(EchoLevel, locFor(EchoLevel)+fstr+"\n", a...)
 	}
 }
 
 // cyan text to output
 func (d DbgMsk) Message(m uint32, fstr string, a ...interface{}) {
-	if 0 != d.Mask&m {
-		output(msgColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if 0 != d.Mask&m && active(MsgLevel) {
+		output(MsgLevel, locFor(MsgLevel)+cs.msg+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // green text to output
 func (d DbgMsk) Info(m uint32, fstr string, a ...interface{}) {
-	if 0 != d.Mask&m {
-		output(infoColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if 0 != d.Mask&m && active(InfoLevel) {
+		output(InfoLevel, locFor(InfoLevel)+cs.info+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // blue text to output
 func (d DbgMsk) Note(m uint32, fstr string, a ...interface{}) {
-	if 0 != d.Mask&m {
-		output(noteColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if 0 != d.Mask&m && active(NoteLevel) {
+		output(NoteLevel, locFor(NoteLevel)+cs.note+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // gray text to output
 func (d DbgMsk) Status(m uint32, fstr string, a ...interface{}) {
-	if 0 != d.Mask&m {
-		output(statColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if 0 != d.Mask&m && active(StatLevel) {
+		output(StatLevel, locFor(StatLevel)+cs.stat+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // orange text to output
 func (d DbgMsk) Warning(m uint32, fstr string, a ...interface{}) {
-	if 0 != d.Mask&m {
-		output(warnColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if 0 != d.Mask&m && active(WarnLevel) {
+		output(WarnLevel, locFor(WarnLevel)+cs.warn+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // yellow (bright orange) text to output
 func (d DbgMsk) Caution(m uint32, fstr string, a ...interface{}) {
-	if 0 != d.Mask&m {
-		output(ccnColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if 0 != d.Mask&m && active(CcnLevel) {
+		output(CcnLevel, locFor(CcnLevel)+cs.ccn+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // magenta text to output
 func (d DbgMsk) Failed(m uint32, fstr string, a ...interface{}) {
-	if 0 != d.Mask&m {
-		outerr(failColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if 0 != d.Mask&m && active(FailLevel) {
+		outerr(FailLevel, locFor(FailLevel)+cs.fail+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // red text to output
 func (d DbgMsk) Error(m uint32, fstr string, a ...interface{}) {
-	if 0 != d.Mask&m {
-		outerr(errColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if 0 != d.Mask&m && active(ErrLevel) {
+		outerr(ErrLevel, locFor(ErrLevel)+cs.err+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // bold white on red background text to output
 func (d DbgMsk) Danger(m uint32, fstr string, a ...interface{}) {
-	if 0 != d.Mask&m {
-		output(fatalColor+fstr+normColor+"\n", a...)
+	cs := curColors()
+	if 0 != d.Mask&m && active(DangerLevel) {
+		output(DangerLevel, locFor(DangerLevel)+cs.fatal+fstr+cs.norm+"\n", a...)
 	}
 }
 
 // output err message if test not true
 func (d DbgMsk) ChkTru(m uint32, l int, tst bool, a ...interface{}) bool {
-	if 0 != d.Mask&m && !tst {
-		outerr("%s\n", failColor+"CHK "+at()+normColor+failed(false, a...))
+	cs := curColors()
+	if 0 != d.Mask&m && !tst && active(FailLevel) {
+		outerr(FailLevel, "%s\n", tagged(cs, cs.fail, chkTag, at())+failed(false, a...))
 	}
 	return !tst
 }
 
 // output err message if given error isn't nil - returns testable boolean
 func (d DbgMsk) ChkErr(m uint32, l int, e error, a ...interface{}) bool {
-	if 0 != d.Mask&m && nil != e {
-		outerr("%s\n", errColor+"ERR "+at()+normColor+errored(false, e, a...))
+	cs := curColors()
+	if 0 != d.Mask&m && nil != e && active(ErrLevel) {
+		outerr(ErrLevel, "%s\n", tagged(cs, cs.err, errTag, at())+errored(false, e, a...))
 	}
 	return (nil != e)
 }
@@ -695,52 +1683,111 @@ func (d DbgMsk) ChkErr(m uint32, l int, e error, a ...interface{}) bool {
 
 // a quick 'I am here' function for debugging & tracking, takes optional trc_args
 func TRC(a ...interface{}) {
-	trcAt(a...)
+	trcAtDepth(output, 1, a...)
 }
 
 // use Dbg interface for TRC
 func (d Dbg) TRC(a ...interface{}) {
 	if d.Enabled {
-		trcAt(a...)
+		trcAtDepth(d.tagOutput, 1, a...)
+	}
+}
+
+// use DbgLvl interface for TRC
+func (d DbgLvl) TRC(l int, a ...interface{}) {
+	if d.Level > 0 && d.Level >= l {
+		trcAtDepth(output, 1, a...)
+	}
+}
+
+// use DbgMsk interface for TRC
+func (d DbgMsk) TRC(m uint32, a ...interface{}) {
+	if 0 != d.Mask&m {
+		trcAtDepth(output, 1, a...)
 	}
 }
 
 // a quick conditional 'I am here' function for debugging & tracking, takes optional trc_args
-//  Remove because we now have (b Dbg) TRC?
 func TRCIF(b bool, a ...interface{}) {
 	if b {
-		trcAt(a...)
+		trcAtDepth(output, 1, a...)
 	}
 }
 
 // a quick 'I came from' function for debugging & tracking, takes optional trc_args
 func TRCFROM(a ...interface{}) {
-	trcBefore(a...)
+	trcBeforeDepth(output, 1, a...)
 }
 
 // use Dbg interface for TRCFROM
 func (d Dbg) TRCFROM(a ...interface{}) {
 	if d.Enabled {
-		trcBefore(a...)
+		trcBeforeDepth(d.tagOutput, 1, a...)
+	}
+}
+
+// output function entry, returning a func to output the exit with elapsed time
+// -- use as:  defer dbg.Trace("myFunc")()
+func Trace(name string) func() {
+	return trcEnter(output, 1, name)
+}
+
+// use Dbg interface for Trace
+func (d Dbg) Trace(name string) func() {
+	if d.Enabled {
+		return trcEnter(d.tagOutput, 1, name)
 	}
+	return func() {}
 }
 
 // ------------------------------------------------------------------------- //
 // Some simple utility routines
 
+// returns the message text of fmt_args as used by the Chk funcs, for building
+// custom checks -- a leading string is the format (used as is if alone), a
+// leading error gives its text (followed by any fmt_args), otherwise returns
+// 'Check failed'
+func FormatArgs(a ...interface{}) string {
+	s := "Check failed"
+	if len(a) > 0 {
+		if f, ok := a[0].(string); ok {
+			s = sprintf(f, a[1:]...)
+		} else if e, ok := a[0].(error); ok {
+			s = fmt.Sprintf("%v", e)
+			if len(a) > 1 {
+				if f, ok := a[1].(string); ok {
+					s += sprintf(f, a[2:]...)
+				}
+			}
+		}
+	}
+	return s
+}
+
 // return the callers func name
 func IAm() string {
+	return funcName(3)
+}
+
+// return the callers fully qualified func name, including the package path
+func IAmFull() string {
 	pc := make([]uintptr, 4)
 	runtime.Callers(2, pc)
-	nm := runtime.FuncForPC(pc[0]).Name()
-	return nm[strings.LastIndex(nm, ".")+1:]
+	return runtime.FuncForPC(pc[0]).Name()
 }
 
+// return the callers caller func name
 func IWas() string {
-	pc := make([]uintptr, 4)
-	runtime.Callers(3, pc)
-	nm := runtime.FuncForPC(pc[0]).Name()
-	return nm[strings.LastIndex(nm, ".")+1:]
+	return funcName(4)
+}
+
+// return the func name 'skip' frames up from the caller -- Caller(0) is the
+// same as IAm(), Caller(1) as IWas(), returns "" if past the top of the stack
+func Caller(skip int) string {
+	if skip < 0 {
+		return ""
+	}
+	return funcName(skip + 3)
 }
 
 // a quick func to output location information (file & line#)
@@ -755,7 +1802,7 @@ func WasAt() string {
 
 // return the callers location information (file & line#)
 func ErrAt() (string, int) {
-	if _, file, line, ok := runtime.Caller(1); ok {
+	if file, line, _ := Location(1); 0 != line {
 		return shortName(file), line
 	}
 	return "", 0
@@ -763,27 +1810,80 @@ func ErrAt() (string, int) {
 
 // return the callers caller location information (file & line#)
 func ErrWasAt() (string, int) {
-	if _, file, line, ok := runtime.Caller(2); ok {
+	if file, line, _ := Location(2); 0 != line {
 		return shortName(file), line
 	}
 	return "", 0
 }
 
+// return the file, line & fully qualified func name 'skip' frames up from the
+// caller -- Location(0) is the callers own location, Location(1) where it was
+// called from, ... -- returns zero values if past the top of the stack
+func Location(skip int) (file string, line int, fn string) {
+	if skip < 0 {
+		return "", 0, ""
+	}
+	pc, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "", 0, ""
+	}
+	if f := runtime.FuncForPC(pc); nil != f {
+		fn = f.Name()
+	}
+	if isRuntime(fn) { // a dbg func run directly as a goroutine
+		if fn, file, line, ok = userCaller(); !ok {
+			return "", 0, ""
+		}
+	}
+	return file, line, fn
+}
+
 // output a stack trace to aid in debugging
 func StackTrace() {
-	callers := make([]uintptr, 10)
-	d := runtime.Callers(0, callers)
-	Message("Depth: %d", d)
+	stackTrace(output)
+}
 
-	frames := runtime.CallersFrames(callers)
-	for {
-		frame, more := frames.Next()
-		if 0 == frame.Line {
-			break
-		}
-		Warning("  Func: %s - %d   %s", frame.Function, frame.Line, path.Dir(frame.File))
-		if !more {
-			break
+// use Dbg interface for StackTrace
+func (d Dbg) StackTrace() {
+	if d.Enabled {
+		stackTrace(d.tagOutput)
+	}
+}
+
+// output the stack (up to ten levels deep) of who called the dbg.func calling this
+func stackTrace(out outFunc) {
+	cs := curColors()
+	frames := captureStack(10, 2)
+	if active(MsgLevel) {
+		out(MsgLevel, locFor(MsgLevel)+cs.msg+"Depth: %d"+cs.norm+"\n", len(frames))
+	}
+	if active(WarnLevel) {
+		for _, f := range frames {
+			out(WarnLevel, locFor(WarnLevel)+cs.warn+"  %s"+cs.norm+"\n", f)
 		}
 	}
 }
+
+// recover from any panic and output the panic value with a stack trace, the
+// panic is swallowed -- must be deferred directly:  defer dbg.Recover()
+func Recover() {
+	if r := recover(); nil != r {
+		recovered(r)
+	}
+}
+
+// output any recovered panic value with a stack trace, returning the value so
+// the caller can decide what to do -- as recover() only works when called
+// directly by the deferred func, pass its result:
+//
+//	defer func() {
+//		if r := dbg.CaptureRecover(recover()); nil != r {
+//			...
+//		}
+//	}()
+func CaptureRecover(r interface{}) interface{} {
+	if nil != r {
+		recovered(r)
+	}
+	return r
+}
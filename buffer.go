@@ -0,0 +1,126 @@
+package dbg
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Buffering of output so that it is output together, e.g. per server request
+
+// Output that accumulates until flushed as a contiguous block, see NewBuffer
+type Buffer struct {
+	mu    sync.Mutex
+	lines []bufLine
+}
+
+type bufLine struct {
+	l Level
+	s string
+}
+
+// returns a Buffer whose output accumulates until Flush (or FlushSorted) is
+// called, so the output of each request of a server stays together:
+//
+//	h := dbg.NewBuffer()
+//	defer h.Flush()
+func NewBuffer() *Buffer {
+	return &Buffer{}
+}
+
+// add text at the given level to the buffer, colored per the level
+func (b *Buffer) add(l Level, fstr string, a ...interface{}) {
+	if !active(l) {
+		return
+	}
+	cs := curColors()
+	if c := cs.level(l); "" != c {
+		fstr = c + fstr + cs.norm
+	}
+	s := fmt.Sprintf(locFor(l)+fstr+"\n", a...)
+	b.mu.Lock()
+	b.lines = append(b.lines, bufLine{l, s})
+	b.mu.Unlock()
+}
+
+// output all the buffered text in the order it was added, with no other output
+// interleaved, emptying the buffer
+func (b *Buffer) Flush() {
+	b.flush(false)
+}
+
+// output all the buffered text as Flush, but sorted by level, most severe first
+func (b *Buffer) FlushSorted() {
+	b.flush(true)
+}
+
+func (b *Buffer) flush(sorted bool) {
+	b.mu.Lock()
+	lines := b.lines
+	b.lines = nil
+	b.mu.Unlock()
+	if sorted {
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].l.rank() > lines[j].l.rank() })
+	}
+	out := make([]string, 0, len(lines))
+	base := baseFields()
+	outMu.Lock()
+	for _, ln := range lines {
+		out = append(out, emitLocked(ln.l, sinkFor(ln.l), nil, ln.s, base))
+	}
+	outMu.Unlock()
+	for n, s := range out {
+		chkFormat(s)
+		callHook(lines[n].l, s)
+	}
+}
+
+// simply echo to the buffer, no color hilites
+func (b *Buffer) Echo(fstr string, a ...interface{}) {
+	b.add(EchoLevel, fstr, a...)
+}
+
+// cyan text to the buffer
+func (b *Buffer) Message(fstr string, a ...interface{}) {
+	b.add(MsgLevel, fstr, a...)
+}
+
+// green text to the buffer
+func (b *Buffer) Info(fstr string, a ...interface{}) {
+	b.add(InfoLevel, fstr, a...)
+}
+
+// blue text to the buffer
+func (b *Buffer) Note(fstr string, a ...interface{}) {
+	b.add(NoteLevel, fstr, a...)
+}
+
+// gray text to the buffer
+func (b *Buffer) Status(fstr string, a ...interface{}) {
+	b.add(StatLevel, fstr, a...)
+}
+
+// orange text to the buffer
+func (b *Buffer) Warning(fstr string, a ...interface{}) {
+	b.add(WarnLevel, fstr, a...)
+}
+
+// yellow (bright orange) text to the buffer
+func (b *Buffer) Caution(fstr string, a ...interface{}) {
+	b.add(CcnLevel, fstr, a...)
+}
+
+// magenta text to the buffer
+func (b *Buffer) Failed(fstr string, a ...interface{}) {
+	b.add(FailLevel, fstr, a...)
+}
+
+// red text to the buffer
+func (b *Buffer) Error(fstr string, a ...interface{}) {
+	b.add(ErrLevel, fstr, a...)
+}
+
+// bold white on red background text to the buffer
+func (b *Buffer) Danger(fstr string, a ...interface{}) {
+	b.add(DangerLevel, fstr, a...)
+}
@@ -0,0 +1,109 @@
+package dbg
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Captured output, see Capture
+type Captured struct {
+	KeepColor bool // keep any color escapes in the captured text (stripped by default)
+
+	mu               sync.Mutex
+	buf              strings.Builder
+	outSink, errSink func(string, ...interface{})
+	restored         bool
+}
+
+// redirect all output (both output & error) into an in-memory buffer until
+// Restore is called -- allows a test to check what was output, color is
+// kept until String / Lines strips it (unless KeepColor is set)
+//
+//	c := dbg.Capture()
+//	defer c.Restore()
+func Capture() *Captured {
+	c := &Captured{}
+	changeConfig(func(s *settings) {
+		c.outSink, c.errSink = s.outSink, s.errSink
+		s.outSink, s.errSink = c.printf, c.printf
+	})
+	return c
+}
+
+func (c *Captured) printf(f string, a ...interface{}) {
+	c.mu.Lock()
+	fmt.Fprintf(&c.buf, f, a...)
+	c.mu.Unlock()
+}
+
+// restore output to where it was before the Capture, safe to call more than once
+func (c *Captured) Restore() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.restored {
+		changeConfig(func(s *settings) { s.outSink, s.errSink = c.outSink, c.errSink })
+		c.restored = true
+	}
+}
+
+// returns all text captured so far
+func (c *Captured) String() string {
+	c.mu.Lock()
+	s := c.buf.String()
+	c.mu.Unlock()
+	if !c.KeepColor {
+		s = stripColor(s)
+	}
+	return s
+}
+
+// returns the lines of text captured so far
+func (c *Captured) Lines() []string {
+	s := strings.TrimSuffix(c.String(), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// The part of a testing.TB (*testing.T, *testing.B, ...) used by ToTestingT,
+// so the package needn't import testing
+type TestLogger interface {
+	Helper()
+	Logf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// route all output (both output & error) through t.Logf, uncolored, so it is
+// attached to the running test and only shown if it fails or with -v -- the
+// previous output is restored when the test finishes
+//
+// the output of the whole package is routed, not just that of the test, so
+// with t.Parallel() tests output of one test may be logged to another
+func ToTestingT(t TestLogger) {
+	prev := curConfig()
+	log := lineOutput(func(s string) {
+		t.Helper()
+		t.Logf("%s", stripColor(s))
+	})
+	changeConfig(func(c *settings) { c.outSink, c.errSink = log, log })
+	t.Cleanup(func() {
+		changeConfig(func(c *settings) { c.outSink, c.errSink = prev.outSink, prev.errSink })
+	})
+}
+
+// route all output (both output & error) through the logger, uncolored and
+// without the extra newline as the logger adds its own -- a nil logger
+// restores the normal output
+func UseStdLog(l *log.Logger) {
+	if nil == l {
+		changeConfig(func(c *settings) { c.outSink, c.errSink = stdout, errout })
+		return
+	}
+	out := lineOutput(func(s string) {
+		l.Print(stripColor(s))
+	})
+	changeConfig(func(c *settings) { c.outSink, c.errSink = out, out })
+}
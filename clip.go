@@ -0,0 +1,59 @@
+package dbg
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Copying output to the system clipboard
+
+var clipCopy = copyToClipboard // how Clip copies text, replaceable for testing
+
+// cyan text to output that is also copied (without color) to the system
+// clipboard, warning if the text couldn't be copied -- nothing is copied
+// when Message output is filtered
+func Clip(fstr string, a ...interface{}) {
+	if !active(MsgLevel) {
+		return
+	}
+	cs := curColors()
+	txt := fmt.Sprintf(fstr, a...)
+	output(MsgLevel, "%s\n", locFor(MsgLevel)+cs.msg+txt+cs.norm)
+	if err := clipCopy(stripColor(txt)); nil != err && active(WarnLevel) {
+		output(WarnLevel, "%s\n", cs.warn+"Clip: unable to copy to clipboard: "+err.Error()+cs.norm)
+	}
+}
+
+// copies the text to the clipboard using the platform's clipboard tool
+func copyToClipboard(text string) error {
+	name, args := clipTool()
+	if "" == name {
+		return errors.New("no clipboard tool found")
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// returns the command (& args) of the platform's clipboard tool, "" if none
+func clipTool() (string, []string) {
+	switch runtime.GOOS {
+	case "darwin":
+		return "pbcopy", nil
+	case "windows":
+		return "clip.exe", nil
+	}
+	for _, t := range [][]string{
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+	} {
+		if _, err := exec.LookPath(t[0]); nil == err {
+			return t[0], t[1:]
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,173 @@
+package dbg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Correlation of output with the fields of a context
+
+type ctxKeyField struct {
+	name string
+	key  interface{}
+}
+
+var (
+	ctxMu     sync.Mutex
+	ctxFields func(context.Context) []Field // extracts fields from a context, nil if none
+	ctxKeys   []ctxKeyField                 // context keys whose values are fields
+	baseCtx   context.Context               // context whose fields follow all output, nil if none
+)
+
+// set the func used to extract the fields (e.g. a request or trace ID) from a
+// context that are added to output, nil to remove it
+func SetContextFields(fn func(context.Context) []Field) {
+	ctxMu.Lock()
+	defer ctxMu.Unlock()
+	ctxFields = fn
+}
+
+// add the value of the context key (if present) as the named field to output
+// of the context, e.g. WithContextExtractor("req", requestIDKey) -- these
+// fields come before any from SetContextFields
+func WithContextExtractor(name string, key interface{}) {
+	ctxMu.Lock()
+	defer ctxMu.Unlock()
+	for n := range ctxKeys {
+		if ctxKeys[n].name == name {
+			ctxKeys[n].key = key
+			return
+		}
+	}
+	ctxKeys = append(ctxKeys, ctxKeyField{name, key})
+}
+
+// set a process wide context whose fields (as extracted by SetContextFields)
+// are added to the end of all output lines, nil to remove it
+func SetBaseContext(ctx context.Context) {
+	ctxMu.Lock()
+	defer ctxMu.Unlock()
+	baseCtx = ctx
+}
+
+// returns the fields of the base context as text to follow a line, skipping
+// any with the key of one of the given fields (of a context derived from it)
+func baseFields(have ...Field) string {
+	ctxMu.Lock()
+	ctx := baseCtx
+	ctxMu.Unlock()
+	var fields []Field
+next:
+	for _, f := range fieldsOf(ctx) {
+		for _, h := range have {
+			if h.Key == f.Key {
+				continue next
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fieldsText(fields)
+}
+
+// returns the fields of the context, nil if none
+func fieldsOf(ctx context.Context) []Field {
+	if nil == ctx {
+		return nil
+	}
+	ctxMu.Lock()
+	fn, keys := ctxFields, ctxKeys
+	ctxMu.Unlock()
+	var fields []Field
+	for _, k := range keys {
+		if v := ctx.Value(k.key); nil != v {
+			fields = append(fields, F(k.name, v))
+		}
+	}
+	if nil != fn {
+		fields = append(fields, fn(ctx)...)
+	}
+	return fields
+}
+
+// output the text at the given level followed by any fields of the context,
+// then those of the base context not already output
+func outCtx(ctx context.Context, l Level, fstr string, a ...interface{}) {
+	cs := curColors()
+	txt := fmt.Sprintf(fstr, a...)
+	if c := cs.level(l); "" != c {
+		txt = c + txt + cs.norm
+	}
+	fields := fieldsOf(ctx)
+	emitWith(l, sinkFor(l), nil, locFor(l)+txt+fieldsText(fields)+"\n", baseFields(fields...))
+}
+
+// simply echo to output followed by any fields of the context
+func EchoCtx(ctx context.Context, fstr string, a ...interface{}) {
+	if active(EchoLevel) {
+		outCtx(ctx, EchoLevel, fstr, a...)
+	}
+}
+
+// cyan text to output followed by any fields of the context
+func MessageCtx(ctx context.Context, fstr string, a ...interface{}) {
+	if active(MsgLevel) {
+		outCtx(ctx, MsgLevel, fstr, a...)
+	}
+}
+
+// green text to output followed by any fields of the context
+func InfoCtx(ctx context.Context, fstr string, a ...interface{}) {
+	if active(InfoLevel) {
+		outCtx(ctx, InfoLevel, fstr, a...)
+	}
+}
+
+// blue text to output followed by any fields of the context
+func NoteCtx(ctx context.Context, fstr string, a ...interface{}) {
+	if active(NoteLevel) {
+		outCtx(ctx, NoteLevel, fstr, a...)
+	}
+}
+
+// gray text to output followed by any fields of the context
+func StatusCtx(ctx context.Context, fstr string, a ...interface{}) {
+	if active(StatLevel) {
+		outCtx(ctx, StatLevel, fstr, a...)
+	}
+}
+
+// orange text to output followed by any fields of the context
+func WarningCtx(ctx context.Context, fstr string, a ...interface{}) {
+	if active(WarnLevel) {
+		outCtx(ctx, WarnLevel, fstr, a...)
+	}
+}
+
+// yellow (bright orange) text to output followed by any fields of the context
+func CautionCtx(ctx context.Context, fstr string, a ...interface{}) {
+	if active(CcnLevel) {
+		outCtx(ctx, CcnLevel, fstr, a...)
+	}
+}
+
+// magenta text to output followed by any fields of the context
+func FailedCtx(ctx context.Context, fstr string, a ...interface{}) {
+	if active(FailLevel) {
+		outCtx(ctx, FailLevel, fstr, a...)
+	}
+}
+
+// red text to output followed by any fields of the context
+func ErrorCtx(ctx context.Context, fstr string, a ...interface{}) {
+	if active(ErrLevel) {
+		outCtx(ctx, ErrLevel, fstr, a...)
+	}
+}
+
+// bold white on red background text to output followed by any fields of the context
+func DangerCtx(ctx context.Context, fstr string, a ...interface{}) {
+	if active(DangerLevel) {
+		outCtx(ctx, DangerLevel, fstr, a...)
+	}
+}
@@ -0,0 +1,83 @@
+package dbg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watching of counters while debugging
+
+type rateSample struct {
+	val int64
+	at  time.Time
+}
+
+var (
+	rateMu    sync.Mutex
+	rateLasts = map[string]rateSample{} // last Rate value & time by label
+
+	countMu sync.Mutex
+	counts  = map[string]int64{} // totals of Count by name
+)
+
+// output the change in a counter and its per second rate since the last call
+// for the label, along with the callers location
+func Rate(label string, current int64) {
+	cs := curColors()
+	t := now()
+	rateMu.Lock()
+	last, ok := rateLasts[label]
+	rateLasts[label] = rateSample{current, t}
+	rateMu.Unlock()
+
+	if !active(MsgLevel) {
+		return
+	}
+	txt := fmt.Sprintf(": %d (first sample)", current)
+	if ok {
+		delta, took := current-last.val, t.Sub(last.at)
+		per := "-"
+		if took > 0 {
+			per = fmt.Sprintf("%.1f", float64(delta)/took.Seconds())
+		}
+		txt = fmt.Sprintf(": %d (%+d in %v, %s/s)", current, delta, took, per)
+	}
+	output(MsgLevel, "%s\n", tagged(cs, cs.msg, ratTag, at())+cs.msg+label+cs.norm+txt)
+}
+
+// count an occurrence of the named event, output the totals with DumpCounts
+func Count(name string) {
+	countMu.Lock()
+	counts[name]++
+	countMu.Unlock()
+}
+
+// output the totals of all Count events, sorted by name
+func DumpCounts() {
+	if !active(MsgLevel) {
+		return
+	}
+	cs := curColors()
+	countMu.Lock()
+	names := make([]string, 0, len(counts))
+	for nm := range counts {
+		names = append(names, nm)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, nm := range names {
+		b.WriteString(fmt.Sprintf("%s: %d\n", cs.msg+nm+cs.norm, counts[nm]))
+	}
+	countMu.Unlock()
+	output(MsgLevel, "%s", b.String())
+}
+
+// clear the totals of all Count events
+func ResetCounts() {
+	countMu.Lock()
+	counts = map[string]int64{}
+	countMu.Unlock()
+}
@@ -2,9 +2,16 @@ package dbg
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jayacarlson/env"
 )
@@ -16,14 +23,53 @@ import (
 */
 
 var (
-	// Can redirect debug output to logging by changing this to log.Printf
-	output = fmt.Printf
-	outerr = errout
-
-	normColor, msgColor, infoColor, noteColor string
-	statColor, warnColor, ccnColor, failColor string
-	errColor, fatalColor                      string
-	blkWARNING, blkCAUTION, blkFAULT          string
+	colors  atomic.Value // *colorSet used for output, see curColors
+	colorMu sync.Mutex   // serializes changes of colors
+
+	config   atomic.Value // *settings used for output, see curConfig
+	configMu sync.Mutex   // serializes changes of settings
+
+	maxOutMu sync.Mutex // guards the Dbg.MaxOut countdowns
+	outMu    sync.Mutex // serializes output so Buffer.Flush output stays together
+	midLine  bool       // true when the last output didn't end a line, guarded by outMu
+
+	noNewline int32 // non-zero to not end each output with a newline, see SetAutoNewline
+
+	strictFmt int32 // non-zero to warn of fmt arg mismatches, see SetStrictFormat
+
+	minLevel int32 // lowest Level of output not filtered, EchoLevel by default
+	silenced int32 // non-zero to skip all output (but Fatal / Panic), see Silence
+	quiet    int32 // number of Quiet scopes skipping all output (but Fatal / Panic)
+
+	errNums  int32 // non-zero to number error lines, see EnableErrorNumbers
+	errCount int64 // number of the last numbered error line
+
+	routeMu sync.Mutex
+	routes  = map[Level]io.Writer{} // levels routed to a writer instead of output
+
+	dbgDir string // directory of the dbg source, used to skip dbg frames
+
+	badgeMu sync.Mutex
+	badges  = map[string]string{} // SGR parameters of Badge colors by label
+
+	locLevels uint32 // bit per level that the simple output funcs show location for
+)
+
+// The tags starting TRC, CHK, ... output, see SetTags
+type tag int
+
+const (
+	trcTag tag = iota // TRC output
+	wasTag            // TRCFROM output
+	chkTag            // CHK output
+	errTag            // ERR output
+	wrnTag            // WarnErr output
+	sizTag            // Size output
+	ratTag            // Rate output
+	valTag            // NonZero output
+	hedTag            // Head output
+	jsnTag            // StructJSON output
+	numTags
 )
 
 // ========================================================================= //
@@ -32,10 +78,384 @@ func init() {
 	if env.IsLinux() {
 		Color() // enable color output on linux systems
 	}
+	if _, file, _, ok := runtime.Caller(0); ok {
+		dbgDir = path.Dir(file)
+	}
+}
+
+// output text at the given level to the normal output sink
+func output(l Level, f string, a ...interface{}) {
+	emit(l, curConfig().outSink, fmt.Sprintf(f, a...))
+}
+
+// an output func (output, outerr, ...) used by helpers outputting for the
+// package funcs & those of a Dbg
+type outFunc func(l Level, f string, a ...interface{})
+
+// output text at the given level to the error output sink
+func outerr(l Level, f string, a ...interface{}) {
+	emit(l, curConfig().errSink, fmt.Sprintf(f, a...))
+}
+
+// output text at the given level to the output normally used for the level
+func outlvl(l Level, f string, a ...interface{}) {
+	emit(l, sinkFor(l), fmt.Sprintf(f, a...))
+}
+
+// returns the output sink normally used for the level
+func sinkFor(l Level) func(string, ...interface{}) {
+	if FailLevel == l || ErrLevel == l {
+		return curConfig().errSink
+	}
+	return curConfig().outSink
+}
+
+// output text to the sink, or any writer the level is routed to, also
+// passing it to any tees
+func emit(l Level, sink func(string, ...interface{}), s string) {
+	emitTo(l, sink, nil, s)
+}
+
+// output text as emit, but to w (if not nil) in place of the sink or any
+// stream or writer the level is set to
+func emitTo(l Level, sink func(string, ...interface{}), w io.Writer, s string) {
+	emitWith(l, sink, w, s, baseFields())
+}
+
+// output text as emitTo, followed by the given base context fields -- these
+// are found before outMu is held as the context extractor may itself output
+func emitWith(l Level, sink func(string, ...interface{}), w io.Writer, s, base string) {
+	outMu.Lock()
+	s = emitLocked(l, sink, w, s, base)
+	outMu.Unlock()
+	chkFormat(s)
+	callHook(l, s)
+}
+
+// output text as emitTo, but with outMu already held, returns the text as output
+// ("" if none) for checking by chkFormat once outMu is released
+func emitLocked(l Level, sink func(string, ...interface{}), w io.Writer, s, base string) string {
+	if "" == s {
+		return ""
+	}
+	if nil == w {
+		sink, w = streamSink(l, sink), routed(l)
+	}
+	if 0 != atomic.LoadInt32(&noNewline) && '\n' == s[len(s)-1] {
+		if s = s[:len(s)-1]; "" == s { // drop the newline ending the output
+			return ""
+		}
+	}
+	note, ok := sampleSite(l)
+	if !ok {
+		return ""
+	}
+	if "" != note && '\n' == s[len(s)-1] {
+		s = s[:len(s)-1] + note + "\n"
+	}
+	if "" != base && '\n' == s[len(s)-1] {
+		s = s[:len(s)-1] + base + "\n"
+	}
+	if ErrLevel == l && 0 != atomic.LoadInt32(&autoStack) && '\n' == s[len(s)-1] {
+		s += autoStackText(int(atomic.LoadInt32(&autoDepth)))
+	}
+	sum, ok := rate.allow(l, s)
+	if !ok {
+		return ""
+	}
+	throttled, ok := burst.allow(l)
+	if !ok {
+		return ""
+	}
+	sum = throttled + sum
+	c := curConfig()
+	start := !midLine // text continuing a line isn't given its lead again
+	midLine = '\n' != s[len(s)-1]
+	lead := indentation()
+	if start && l.rank() >= FailLevel && 0 != atomic.LoadInt32(&errNums) {
+		lead = fmt.Sprintf("[#%d] ", atomic.AddInt64(&errCount, 1)) + lead
+	}
+	if "" != c.prefix {
+		lead = c.prefix + " " + lead
+	}
+	if "" != c.hostname {
+		lead = c.hostname + " " + lead
+	}
+	f := Format(atomic.LoadInt32(&format))
+	if FormatText == f && "" != c.tsLayout {
+		lead = c.now().Format(c.tsLayout) + " " + lead
+	}
+	if s = leading(lead, s); !start { // every line of multi-line output gets the lead
+		s = strings.TrimPrefix(s, lead)
+	}
+	if FormatText != f {
+		s = formatted(f, l, sum) + formatted(f, l, s)
+	} else {
+		s = sum + s
+		if cols := int(atomic.LoadInt32(&maxWidth)); cols > 0 {
+			s = wrapText(s, cols)
+		}
+	}
+	write(w, sink, s)
+	return s
+}
+
+// write output text to w (stripped of color as set for w) or the sink if w
+// is nil, and to any tees, holding onto it instead while output is paused by
+// Prompt -- outMu must be held
+func write(w io.Writer, sink func(string, ...interface{}), s string) {
+	if paused {
+		held = append(held, heldOut{w, sink, s})
+		return
+	}
+	if nil != w {
+		writeTo(w, s)
+	} else {
+		sink("%s", s)
+	}
+	tee(s)
+}
+
+// matches the text fmt puts in place of a bad verb or arg, e.g. %!d(MISSING),
+// %!(EXTRA int=1) or %!d(string=hi), but not a "%!" the text simply contains
+var badFormat = regexp.MustCompile(`%!.?\((MISSING\)|EXTRA |NOVERB\)|BAD(WIDTH|PREC|INDEX)\)|[\w.*\[\]]+=)`)
+
+// output a warning at the callers location if the output text shows fmt found
+// a mismatch of verbs & args, e.g. %!d(MISSING) or %!(EXTRA ...)
+func chkFormat(s string) {
+	if 0 == atomic.LoadInt32(&strictFmt) || !strings.Contains(s, "%!") || !badFormat.MatchString(s) {
+		return
+	}
+	cs := curColors()
+	loc := ""
+	if _, file, line, ok := userCaller(); ok {
+		loc = fmt.Sprintf("@ %d in %s%s", line, shortName(file), curConfig().locSep)
+	}
+	outerr(WarnLevel, "%s\n", cs.warn+"FMT "+loc+cs.norm+"format verbs & args mismatch")
+}
+
+// pass output text along to anything that keeps a copy of all output
+func tee(s string) {
+	ringBuf.add(s)
+	teeMu.Lock()
+	defer teeMu.Unlock()
+	for _, t := range tees {
+		if t.strip {
+			io.WriteString(t.w, stripColor(s))
+		} else {
+			io.WriteString(t.w, s)
+		}
+	}
+}
+
+// The settings used by output, set by SetOutput, SetPrefix, ... -- as with the
+// colors a set is never changed once in use, changes swap in a new set
+type settings struct {
+	outSink, errSink func(string, ...interface{}) // where output & error output go
+	outW, errW       io.Writer                    // writers of output & error output set by SetOutput
+	persist          io.Writer                    // where Persist output is also written, nil if none
+	now              func() time.Time             // clock used for timestamps & elapsed times
+	tsLayout         string                       // time.Format layout of line timestamps, "" for none
+	prefix           string                       // text (and a space) starting each line after any timestamp
+	hostname         string                       // short host name (and a space) starting each line, "" for none
+	exit             func(int)                    // how to exit for the fatal funcs, replaceable for testing
+	exitCode         int                          // exit code used by the fatal funcs
+	locSep           string                       // separator between location and message of TRC/CHK output
+	tags             [numTags]string              // tags (and a space) starting TRC, CHK, ... output
+}
+
+var defSettings = &settings{ // settings used until first changed
+	outSink: stdout, errSink: errout,
+	outW: os.Stdout, errW: os.Stderr,
+	now:  time.Now,
+	exit: os.Exit, exitCode: -1,
+	locSep: "  ",
+	tags:   [numTags]string{"TRC ", "WAS ", "CHK ", "ERR ", "WRN ", "SIZ ", "RAT ", "VAL ", "HED ", "JSN "},
+}
+
+// returns the current settings, output reads these once per call as with
+// the colors -- never change the returned settings, use changeConfig
+func curConfig() *settings {
+	if c, ok := config.Load().(*settings); ok {
+		return c
+	}
+	return defSettings
+}
+
+// set the settings used for output to a copy of the current settings as changed by f
+func changeConfig(f func(c *settings)) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	c := *curConfig()
+	f(&c)
+	config.Store(&c)
+}
+
+// returns the current time of the clock set by SetClock
+func now() time.Time {
+	return curConfig().now()
+}
+
+// exit as the fatal funcs do, see SetExitFunc & SetExitCode
+func exit() {
+	c := curConfig()
+	c.exit(c.exitCode)
+}
+
+func stdout(f string, a ...interface{}) {
+	writeTo(os.Stdout, fmt.Sprintf(f, a...))
 }
 
 func errout(f string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, f, a...) // why not going to Stderr?
+	writeTo(os.Stderr, fmt.Sprintf(f, a...))
+}
+
+// The colors (escape sequences) used for output, all "" when color is off --
+// a set is never changed once in use, changes swap in a new set as a whole
+type colorSet struct {
+	norm, msg, info, note, stat, warn, ccn, fail, err, fatal string
+	blkWARNING, blkCAUTION, blkFAULT                         string
+	on                                                       bool // true when Color() is active
+}
+
+var noColors = &colorSet{} // colors used until Color() / NoColor() is called
+
+// returns the current colors, output funcs read this once per call so any
+// concurrent Color() / NoColor() can't mix the colors of a line
+func curColors() *colorSet {
+	if cs, ok := colors.Load().(*colorSet); ok {
+		return cs
+	}
+	return noColors
+}
+
+// set the colors used for output to a copy of the current colors as changed by f
+func changeColors(f func(cs *colorSet)) {
+	colorMu.Lock()
+	defer colorMu.Unlock()
+	cs := *curColors()
+	f(&cs)
+	colors.Store(&cs)
+}
+
+// returns the color used for output at the given level
+func (cs *colorSet) level(l Level) string {
+	switch l {
+	case StatLevel:
+		return cs.stat
+	case NoteLevel:
+		return cs.note
+	case InfoLevel:
+		return cs.info
+	case MsgLevel:
+		return cs.msg
+	case WarnLevel:
+		return cs.warn
+	case CcnLevel:
+		return cs.ccn
+	case FailLevel:
+		return cs.fail
+	case ErrLevel:
+		return cs.err
+	case DangerLevel:
+		return cs.fatal
+	}
+	return ""
+}
+
+// set the color used for output at the given level, levels without a color
+// (TrcLevel & EchoLevel) are ignored
+func (cs *colorSet) setLevel(l Level, c string) {
+	switch l {
+	case StatLevel:
+		cs.stat = c
+	case NoteLevel:
+		cs.note = c
+	case InfoLevel:
+		cs.info = c
+	case MsgLevel:
+		cs.msg = c
+	case WarnLevel:
+		cs.warn = c
+	case CcnLevel:
+		cs.ccn = c
+	case FailLevel:
+		cs.fail = c
+	case ErrLevel:
+		cs.err = c
+	case DangerLevel:
+		cs.fatal = c
+	}
+}
+
+// returns true if the terminal claims support for 24-bit (truecolor) color
+func truecolor() bool {
+	ct := strings.ToLower(os.Getenv("COLORTERM"))
+	return "truecolor" == ct || "24bit" == ct
+}
+
+// returns any writer output at the given level is routed to
+func routed(l Level) io.Writer {
+	routeMu.Lock()
+	defer routeMu.Unlock()
+	return routes[l]
+}
+
+// returns true if output at the given level is not filtered (or silenced) --
+// checked before any formatting of the output
+func active(l Level) bool {
+	return 0 == atomic.LoadInt32(&silenced) && 0 == atomic.LoadInt32(&quiet) && l.rank() >= Level(atomic.LoadInt32(&minLevel)).rank()
+}
+
+// returns the level to filter & order output at the level as, TrcLevel being
+// added after the other levels is treated as EchoLevel
+func (l Level) rank() Level {
+	if TrcLevel == l {
+		return EchoLevel
+	}
+	return l
+}
+
+// returns an output func that collects text into full lines, passing each
+// complete line (without the newline) to the given func -- for sinks such
+// as testing.T.Logf that add their own newline to each call
+func lineOutput(fn func(string)) func(string, ...interface{}) {
+	var mu sync.Mutex
+	var part string
+	return func(f string, a ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		part += fmt.Sprintf(f, a...)
+		for {
+			n := strings.IndexByte(part, '\n')
+			if n < 0 {
+				break
+			}
+			fn(part[:n])
+			part = part[n+1:]
+		}
+	}
+}
+
+// returns the string with any color escape sequences (\033[...m) removed
+func stripColor(s string) string {
+	if !strings.Contains(s, "\033[") {
+		return s
+	}
+	var b strings.Builder
+	esc := false
+	for n := 0; n < len(s); n++ {
+		switch {
+		case esc:
+			esc = s[n] != 'm' // sequence ends with the 'm'
+		case s[n] == '\033' && n+1 < len(s) && s[n+1] == '[':
+			esc = true
+			n++
+		default:
+			b.WriteByte(s[n])
+		}
+	}
+	return b.String()
 }
 
 // returns a shortened file name with minimal leading path
@@ -50,57 +470,211 @@ func shortName(s string) string {
 	return s[p:]
 }
 
-// outputs location information, 2 steps back (who called the dbg.func)
-func trcAt(a ...interface{}) {
-	if _, file, line, ok := runtime.Caller(2); ok {
-		file = shortName(file)
-		output("TRC @ %d in %s ", line, file)
+// returns the location 'skip' steps back from the caller, like runtime.Caller,
+// but if that frame can't be resolved or is inside the runtime (e.g. a dbg func
+// started directly as a goroutine) it falls back to userCaller
+func caller(skip int) (fn, file string, line int, ok bool) {
+	if pc, file, line, ok := runtime.Caller(skip + 1); ok {
+		if f := runtime.FuncForPC(pc); f != nil && !isRuntime(f.Name()) {
+			return f.Name(), file, line, true
+		}
 	}
-	trc(a...)
+	return userCaller()
 }
 
-// outputs location information, 3 steps back (who called the function calling dbg.func)
-func trcBefore(a ...interface{}) {
-	if _, file, line, ok := runtime.Caller(3); ok {
-		file = shortName(file)
-		output("WAS @ %d in %s ", line, file)
+// returns the location of the first frame outside of the runtime & dbg,
+// lastly falling back to where the goroutine was created
+func userCaller() (fn, file string, line int, ok bool) {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		f, more := frames.Next()
+		if f.Line > 0 && !isRuntime(f.Function) && !isDbg(f.File) {
+			return f.Function, f.File, f.Line, true
+		}
+		if !more {
+			break
+		}
+	}
+	return createdBy()
+}
+
+// returns true for functions within the go runtime
+func isRuntime(fn string) bool {
+	return strings.HasPrefix(fn, "runtime.")
+}
+
+// returns true for files of the dbg package itself (not its tests)
+func isDbg(file string) bool {
+	return path.Dir(file) == dbgDir && !strings.HasSuffix(file, "_test.go")
+}
+
+// returns the location that created the current goroutine by digging
+// through the 'created by' entry of the goroutine's stack dump
+func createdBy() (fn, file string, line int, ok bool) {
+	buf := make([]byte, 4096)
+	lines := strings.Split(string(buf[:runtime.Stack(buf, false)]), "\n")
+	for n := len(lines) - 2; n >= 0; n-- {
+		if !strings.HasPrefix(lines[n], "created by ") {
+			continue
+		}
+		fn = strings.TrimPrefix(lines[n], "created by ")
+		if i := strings.Index(fn, " in goroutine"); i > 0 {
+			fn = fn[:i]
+		}
+		loc := strings.TrimSpace(lines[n+1])
+		if i := strings.LastIndex(loc, " +0x"); i > 0 {
+			loc = loc[:i]
+		}
+		if i := strings.LastIndex(loc, ":"); i > 0 {
+			if l, err := strconv.Atoi(loc[i+1:]); err == nil {
+				return fn, loc[:i], l, true
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+// outputs location information of the caller 'skip' steps back from the
+// dbg.func calling this -- 1 for who called the dbg.func, unless TrcLevel
+// output is filtered by SetMinLevel
+func trcAtDepth(out outFunc, skip int, a ...interface{}) {
+	if !active(TrcLevel) {
+		return
+	}
+	loc := ""
+	if _, file, line, ok := caller(skip + 1); ok {
+		c := curConfig()
+		loc = fmt.Sprintf("%s@ %d in %s%s", c.tags[trcTag], line, shortName(file), c.locSep)
+	}
+	out(TrcLevel, "%s%s\n", loc, trc(a...))
+}
+
+// outputs location information of the caller 'skip' steps back from the
+// dbg.func calling this -- 1 for who called the function calling the dbg.func
+func trcBeforeDepth(out outFunc, skip int, a ...interface{}) {
+	if !active(TrcLevel) {
+		return
+	}
+	loc := ""
+	if _, file, line, ok := caller(skip + 2); ok {
+		c := curConfig()
+		loc = fmt.Sprintf("%s@ %d in %s%s", c.tags[wasTag], line, shortName(file), c.locSep)
+	}
+	out(TrcLevel, "%s%s\n", loc, trc(a...))
+}
+
+// outputs function entry of the caller 'skip' steps back from this (1 for who
+// called the dbg.func), returns the func that outputs the function exit and
+// elapsed time
+func trcEnter(out outFunc, skip int, name string) func() {
+	if !active(TrcLevel) {
+		return func() {}
+	}
+	cs := curColors()
+	if _, file, line, ok := caller(skip + 1); ok {
+		out(TrcLevel, "--> %s @ %d in %s\n", cs.msg+name+cs.norm, line, shortName(file))
+	} else {
+		out(TrcLevel, "--> %s\n", cs.msg+name+cs.norm)
+	}
+	start := now()
+	return func() {
+		out(TrcLevel, "<-- %s %s\n", cs.msg+name+cs.norm, cs.stat+"("+now().Sub(start).String()+")"+cs.norm)
 	}
-	trc(a...)
 }
 
-// output trc info -- see trc_args
-func trc(a ...interface{}) {
+// returns trc info text -- see trc_args
+func trc(a ...interface{}) string {
+	cs := curColors()
 	s := ""
 	if len(a) > 0 {
 		if f, ok := a[0].(string); ok { // string with possible args
-			s = fmt.Sprintf(msgColor+f+normColor, a[1:]...)
+			s = fmt.Sprintf(cs.msg+f+cs.norm, a[1:]...)
+		} else if len(a) > 1 { // loose values, output space separated
+			s = cs.msg + strings.TrimSuffix(fmt.Sprintln(a...), "\n") + cs.norm
 		} else if e, ok := a[0].(error); ok { // error, output error text
-			s = fmt.Sprintf(errColor+"%v"+normColor, e)
+			s = fmt.Sprintf(cs.err+"%v"+cs.norm, e)
 		} else if nil == a[0] { // condition where given error is NIL
-			s = fmt.Sprintf(infoColor + "nil" + normColor)
+			s = fmt.Sprintf(cs.info + "nil" + cs.norm)
+		} else { // a single loose value
+			s = fmt.Sprintf(cs.msg+"%v"+cs.norm, a[0])
 		}
 	}
-	output("%s\n", s)
+	return s
+}
+
+// returns the callers location for the simple output funcs at the given level,
+// "" unless set to be shown for the level by SetLocationForLevel
+func locFor(l Level) string {
+	if 0 == atomic.LoadUint32(&locLevels)&(1<<uint(l)) {
+		return ""
+	}
+	if _, file, line, ok := userCaller(); ok {
+		return fmt.Sprintf("@ %d in %s%s", line, shortName(file), curConfig().locSep)
+	}
+	return ""
+}
+
+// returns the tag (colored c) & location (gray) starting CHK/ERR/... output
+func tagged(cs *colorSet, c string, t tag, loc string) string {
+	txt := curConfig().tags[t]
+	if "" == loc {
+		return c + txt + cs.norm
+	}
+	return c + txt + cs.norm + cs.stat + loc + cs.norm
 }
 
 // returns location of CHK caller
 func at() string {
-	if _, file, line, ok := runtime.Caller(2); ok {
+	if _, file, line, ok := caller(2); ok {
 		file = shortName(file)
-		return fmt.Sprintf("@ %d in %s  ", line, file)
+		return fmt.Sprintf("@ %d in %s%s", line, file, curConfig().locSep)
 	}
 	return ""
 }
 
+// return the func name (without package) 'skip' frames up, as runtime.Callers,
+// or "" if past the top of the stack
+func funcName(skip int) string {
+	pc := make([]uintptr, 1)
+	if 0 == runtime.Callers(skip, pc) {
+		return ""
+	}
+	nm := runtime.FuncForPC(pc[0]).Name()
+	return nm[strings.LastIndex(nm, ".")+1:]
+}
+
 // return location line, file & func as string
 func funcAt(d int) string {
-	if uptr, file, line, ok := runtime.Caller(d + 1); ok {
-		name := runtime.FuncForPC(uptr).Name()
+	if file, line, name := Location(d + 1); 0 != line {
 		return fmt.Sprintf("@ %d in %s - %s()", line, shortName(file), name[strings.LastIndex(name, "/")+1:])
 	}
 	return "@ <UNKNOWN>"
 }
 
+// output a recovered panic value along with the stack of the panic, skipping
+// the runtime's panic handling and dbg frames
+func recovered(r interface{}) {
+	if !active(ErrLevel) {
+		return
+	}
+	cs := curColors()
+	txt := fmt.Sprintf("%sPANIC: %v%s\n", cs.err, r, cs.norm)
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for n := 0; n < 10; {
+		f, more := frames.Next()
+		if f.Line > 0 && !isRuntime(f.Function) && !isDbg(f.File) {
+			txt += fmt.Sprintf("%s  Func: %s - %d   %s%s\n", cs.err, f.Function, f.Line, path.Dir(f.File), cs.norm)
+			n++
+		}
+		if !more {
+			break
+		}
+	}
+	outerr(ErrLevel, "%s", txt)
+}
+
 // return arg text after calling any possible CLOSER()
 func failed(c bool, a ...interface{}) string {
 	if len(a) > 0 && c {
@@ -123,26 +697,37 @@ func errored(c bool, e error, a ...interface{}) string {
 			}
 		}
 		txt = genText(a...)
+	} else if isNil(e) { // calling Error() on it would likely panic
+		txt = fmt.Sprintf("typed nil error (%T) is not a nil error", e)
 	} else {
 		txt = fmt.Sprintf("%v", e)
 	}
 	return txt
 }
 
-// generates text for output, supplying a 'Check failed' if none given
-func genText(a ...interface{}) string {
-	s := "Check failed"
+// return error wrapped with any arg text as a prefix after calling any possible CLOSER()
+func wrapped(e error, a ...interface{}) error {
 	if len(a) > 0 {
-		if f, ok := a[0].(string); ok {
-			s = fmt.Sprintf(f, a[1:]...)
-		} else if e, ok := a[0].(error); ok {
-			s = fmt.Sprintf("%v", e)
-			if len(a) > 1 {
-				if f, ok := a[1].(string); ok {
-					s += fmt.Sprintf(f, a[2:]...)
-				}
-			}
+		if cl, ok := a[len(a)-1].(func()); ok {
+			cl()             // call closer function
+			a = a[:len(a)-1] // remove it from arg list
 		}
 	}
-	return s
+	if 0 == len(a) {
+		return e
+	}
+	return fmt.Errorf("%s: %w", genText(a...), e)
+}
+
+// generates text for output, see FormatArgs
+func genText(a ...interface{}) string {
+	return FormatArgs(a...)
+}
+
+// returns the formatted text, or the format string as is if there are no args
+func sprintf(f string, a ...interface{}) string {
+	if 0 == len(a) {
+		return f
+	}
+	return fmt.Sprintf(f, a...)
 }
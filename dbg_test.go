@@ -1,15 +1,29 @@
 package dbg
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var (
 	panicErr = errors.New("MyPanicErr")
 	myErr    = errors.New("MyErr")
 
+	testFile = thisFile() // this file as shown in output, e.g. dbg/dbg_test.go
+
 	tx, ex        bool
 	fx, fif, ferr bool
 	cdx           bool
@@ -24,6 +38,25 @@ func init() {
 	flag.BoolVar(&cdx, "cdx", false, "Test countdown dbg")
 }
 
+// returns all output (stdout & stderr) done while calling f
+func captured(f func()) string {
+	c := Capture()
+	defer c.Restore()
+	f()
+	return c.String()
+}
+
+// returns the line number of the caller
+func thisFile() string {
+	_, f, _, _ := runtime.Caller(0)
+	return shortName(f)
+}
+
+func line() int {
+	_, _, l, _ := runtime.Caller(1)
+	return l
+}
+
 func chkCloser() {
 	Message("Closer was called")
 }
@@ -248,3 +281,2451 @@ func TestDbg(t *testing.T) {
 	Message("Should see\nERR @ ### in dbg/dbg_test.go  My error text")
 	ChkErr(myErr, "My error text")
 }
+
+func TestIfActive(t *testing.T) {
+	defer SetMinLevel(EchoLevel)
+
+	called := false
+	IfActive(InfoLevel, func() { called = true })
+	if !called {
+		t.Error("IfActive did not call func with no filtering")
+	}
+
+	SetMinLevel(WarnLevel)
+	called = false
+	IfActive(InfoLevel, func() { called = true })
+	if called {
+		t.Error("IfActive called func for level below minimum")
+	}
+	IfActive(ErrLevel, func() { called = true })
+	if !called {
+		t.Error("IfActive did not call func for level above minimum")
+	}
+}
+
+func TestTrace(t *testing.T) {
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ticks := 0
+	SetClock(func() time.Time { ticks++; return t0.Add(time.Duration(ticks) * 5 * time.Millisecond) })
+	defer SetClock(nil)
+
+	l := line() + 1
+	s := captured(func() { Trace("traced")() })
+	if want := fmt.Sprintf("--> traced @ %d in "+testFile+"\n<-- traced (5ms)\n", l); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+
+	bug := Dbg{}
+	if s := captured(func() { bug.Trace("bug{false} Trace")() }); "" != s {
+		t.Errorf("disabled Dbg Trace output %q", s)
+	}
+	bug.Enabled = true
+	l = line() + 1
+	s = captured(func() { bug.Trace("bug{true} Trace")() })
+	if want := fmt.Sprintf("--> bug{true} Trace @ %d in "+testFile+"\n<-- bug{true} Trace (5ms)\n", l); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+
+	c := Capture()
+	l = line() + 1
+	go bug.Trace("spawned")
+	for end := time.Now().Add(time.Second); 0 == len(c.Lines()) && time.Now().Before(end); {
+		time.Sleep(time.Millisecond)
+	}
+	c.Restore()
+	if want := fmt.Sprintf("--> spawned @ %d in "+testFile, l); c.String() != want+"\n" {
+		t.Errorf("expected Trace started by go to locate the go statement %q, got %q", want, c.String())
+	}
+}
+
+func TestLvlMskTRC(t *testing.T) {
+	lvl := DbgLvl{3}
+	if s := captured(func() { lvl.TRC(3, "lvl{3} 3") }); !strings.Contains(s, "lvl{3} 3") {
+		t.Errorf("DbgLvl.TRC not output at level: %q", s)
+	} else if !strings.Contains(s, "dbg_test.go") {
+		t.Errorf("DbgLvl.TRC location not at call site: %q", s)
+	}
+	if s := captured(func() { lvl.TRC(4, "lvl{3} 4") }); s != "" {
+		t.Errorf("DbgLvl.TRC output above level: %q", s)
+	}
+	lvl.Level = 0
+	if s := captured(func() { lvl.TRC(0, "lvl{0} 0") }); s != "" {
+		t.Errorf("DbgLvl.TRC output with level 0: %q", s)
+	}
+
+	msk := DbgMsk{0xA}
+	if s := captured(func() { msk.TRC(2, "msk{xA} 2") }); !strings.Contains(s, "msk{xA} 2") {
+		t.Errorf("DbgMsk.TRC not output for mask: %q", s)
+	}
+	if s := captured(func() { msk.TRC(5, "msk{xA} 5") }); s != "" {
+		t.Errorf("DbgMsk.TRC output for unset mask: %q", s)
+	}
+}
+
+func TestGoroutineLocation(t *testing.T) {
+	done := make(chan string)
+	o := curConfig().errSink
+	changeConfig(func(c *settings) { c.errSink = func(f string, a ...interface{}) { done <- fmt.Sprintf(f, a...) } })
+	defer changeConfig(func(c *settings) { c.errSink = o })
+
+	go ChkTru(false, "from goroutine") // dbg func directly as the goroutine
+	s := <-done
+	if strings.Contains(s, "runtime") || !strings.Contains(s, "dbg_test.go") {
+		t.Errorf("goroutine location not resolved: %q", s)
+	}
+
+	go func() { done <- ImAt() }()
+	if s = <-done; strings.Contains(s, "UNKNOWN") || !strings.Contains(s, "dbg_test.go") {
+		t.Errorf("goroutine location not resolved: %q", s)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	var p strings.Builder
+	SetPersist(&p)
+	defer SetPersist(nil)
+
+	s := captured(func() { Persist(WarnLevel, "Persist %d", 1) })
+	if !strings.Contains(s, "Persist 1") {
+		t.Errorf("Persist not output: %q", s)
+	}
+	if p.String() != "Persist 1\n" {
+		t.Errorf("Persist not written to persist writer: %q", p.String())
+	}
+}
+
+func TestTRCLine(t *testing.T) {
+	bug := Dbg{Enabled: true}
+	lvl := DbgLvl{1}
+	msk := DbgMsk{1}
+
+	chk := func(what, s string, l int) {
+		if !strings.Contains(s, fmt.Sprintf("TRC @ %d in "+testFile, l)) {
+			t.Errorf("%s reported wrong location, expected line %d: %q", what, l, s)
+		}
+	}
+	s, l := captured(func() { TRC("free") }), line()
+	chk("TRC", s, l)
+	s, l = captured(func() { bug.TRC("method") }), line()
+	chk("Dbg.TRC", s, l)
+	s, l = captured(func() { TRCIF(true, "if") }), line()
+	chk("TRCIF", s, l)
+	s, l = captured(func() { lvl.TRC(1, "lvl") }), line()
+	chk("DbgLvl.TRC", s, l)
+	s, l = captured(func() { msk.TRC(1, "msk") }), line()
+	chk("DbgMsk.TRC", s, l)
+}
+
+func TestCapture(t *testing.T) {
+	c := Capture()
+	Info("Captured info")
+	Error("Captured %s", "error")
+	c.Restore()
+	c.Restore()                     // safe to restore again
+	Echo("Not captured, Echo text") // should be output
+
+	if l := c.Lines(); len(l) != 2 || l[0] != "Captured info" || l[1] != "Captured error" {
+		t.Errorf("Capture lines not as expected: %q", l)
+	}
+	c.KeepColor = true
+	if ColorEnabled() && !strings.Contains(c.String(), curColors().info) {
+		t.Errorf("Capture did not keep color: %q", c.String())
+	}
+}
+
+func TestLocationSeparator(t *testing.T) {
+	SetLocationSeparator(" | ")
+	defer SetLocationSeparator("  ")
+
+	if s := captured(func() { ChkTru(false, "chk msg") }); !strings.Contains(s, testFile+" | chk msg") {
+		t.Errorf("CHK separator not used: %q", s)
+	}
+	if s := captured(func() { TRC("trc msg") }); !strings.Contains(s, testFile+" | trc msg") {
+		t.Errorf("TRC separator not used: %q", s)
+	}
+}
+
+func TestSize(t *testing.T) {
+	sl := make([]int, 3, 10)
+	mp := map[string]int{"a": 1, "b": 2}
+
+	if s := captured(func() { Size("slice", sl) }); !strings.Contains(s, "slice: len=3 cap=10") {
+		t.Errorf("Size of slice not as expected: %q", s)
+	}
+	if s := captured(func() { Size("map", mp) }); !strings.Contains(s, "map: len=2") {
+		t.Errorf("Size of map not as expected: %q", s)
+	}
+	if s := captured(func() { Size("string", "hello") }); !strings.Contains(s, "string: len=5") {
+		t.Errorf("Size of string not as expected: %q", s)
+	}
+	if s := captured(func() { Size("int", 5) }); !strings.Contains(s, "int: unsupported kind int") {
+		t.Errorf("Size of unsupported kind not as expected: %q", s)
+	}
+}
+
+type fakeTB struct {
+	testing.TB
+	logs     []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper()           {}
+func (f *fakeTB) Cleanup(fn func()) { f.cleanups = append(f.cleanups, fn) }
+func (f *fakeTB) Logf(fstr string, a ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprintf(fstr, a...))
+}
+
+func TestToTestingT(t *testing.T) {
+	ToTestingT(t) // real use, output shown with -v
+
+	f := &fakeTB{}
+	ToTestingT(f)
+	Info("Info to test log")
+	TRC("TRC to test log")
+	for _, fn := range f.cleanups {
+		fn()
+	}
+
+	if len(f.logs) != 2 || f.logs[0] != "Info to test log" || !strings.HasSuffix(f.logs[1], "TRC to test log") {
+		t.Errorf("output not routed to test log: %q", f.logs)
+	}
+	if strings.Contains(f.logs[0], "\033[") {
+		t.Errorf("test log output not uncolored: %q", f.logs[0])
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	EnableRingBuffer(3)
+	defer EnableRingBuffer(0)
+
+	captured(func() {
+		for n := 1; n <= 5; n++ {
+			Info("ring %d", n)
+		}
+	})
+	var b strings.Builder
+	DumpRingBuffer(&b)
+	if b.String() != "ring 3\nring 4\nring 5\n" {
+		t.Errorf("ring buffer not as expected: %q", b.String())
+	}
+
+	ClearRingBuffer()
+	captured(func() { Error("ring err") })
+	b.Reset()
+	DumpRingBuffer(&b)
+	if b.String() != "ring err\n" {
+		t.Errorf("ring buffer not cleared: %q", b.String())
+	}
+}
+
+func TestRouteLevelScoped(t *testing.T) {
+	var outer, inner strings.Builder
+	RouteLevel(ErrLevel, &outer)
+	defer RouteLevel(ErrLevel, nil)
+
+	restore := RouteLevelScoped(ErrLevel, &inner)
+	s := captured(func() {
+		Error("scoped error")
+		Info("scoped info")
+	})
+	restore()
+	Error("outer error")
+
+	if inner.String() != "scoped error\n" {
+		t.Errorf("Error not routed within scope: %q", inner.String())
+	}
+	if s != "scoped info\n" {
+		t.Errorf("Info should not have been routed: %q", s)
+	}
+	if !strings.Contains(outer.String(), "outer error") || strings.Contains(outer.String(), "scoped") {
+		t.Errorf("previous routing not restored: %q", outer.String())
+	}
+}
+
+func TestErrorNumbers(t *testing.T) {
+	EnableErrorNumbers(true)
+	defer EnableErrorNumbers(false)
+
+	l := Capture()
+	Info("info")
+	Error("error")
+	Warning("warning")
+	Failed("failed")
+	Danger("danger")
+	l.Restore()
+
+	exp := []string{"info", "[#1] error", "warning", "[#2] failed", "[#3] danger"}
+	if got := l.Lines(); strings.Join(got, "|") != strings.Join(exp, "|") {
+		t.Errorf("error numbers not as expected: %q", got)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	SetRateLimit(time.Hour)
+	defer SetRateLimit(0)
+
+	l := Capture()
+	for n := 0; n < 3; n++ {
+		Warning("same thing")
+	}
+	Info("other thing")
+	Info("other thing")
+	Danger("bad thing")
+	Danger("bad thing")
+	l.Restore()
+
+	exp := []string{"same thing", "(repeated 2 times) same thing", "other thing", "bad thing", "bad thing"}
+	if got := l.Lines(); strings.Join(got, "|") != strings.Join(exp, "|") {
+		t.Errorf("rate limited output not as expected: %q", got)
+	}
+}
+
+func TestPanicWrapIfErr(t *testing.T) {
+	closed := false
+	rcv := func() (r interface{}) {
+		defer func() { r = recover() }()
+		PanicWrapIfErr(nil, "not wrapped")
+		PanicWrapIfErr(panicErr, "loading %s", "config.yaml", func() { closed = true })
+		return nil
+	}()
+
+	err, ok := rcv.(error)
+	if !ok || !errors.Is(err, panicErr) {
+		t.Fatalf("recovered value does not wrap the error: %v", rcv)
+	}
+	if err.Error() != "loading config.yaml: MyPanicErr" {
+		t.Errorf("wrapped error text not as expected: %q", err.Error())
+	}
+	if !closed {
+		t.Error("closer was not called")
+	}
+}
+
+func TestChkWithin(t *testing.T) {
+	var fast, slow bool
+	s := captured(func() {
+		fast = ChkWithin(time.Second, func() {}, "fast func")
+		slow = ChkWithin(time.Millisecond, func() { time.Sleep(5 * time.Millisecond) }, "slow func")
+	})
+	if fast || !slow {
+		t.Errorf("ChkWithin results not as expected: fast %v slow %v", fast, slow)
+	}
+	if strings.Contains(s, "fast func") || !strings.Contains(s, "slow func (took ") {
+		t.Errorf("ChkWithin output not as expected: %q", s)
+	}
+}
+
+func TestOrdered(t *testing.T) {
+	vals := map[string]interface{}{"user": 42, "attempt": 3, "ok": true}
+	s := captured(func() { Ordered(InfoLevel, "event", []string{"user", "attempt", "ok", "extra"}, vals) })
+	if s != "event user=42 attempt=3 ok=true extra=<missing>\n" {
+		t.Errorf("Ordered fields not as expected: %q", s)
+	}
+}
+
+func TestChkErrListE(t *testing.T) {
+	if nil != JoinErrs([]error{nil, nil}) {
+		t.Error("JoinErrs of nil errors not nil")
+	}
+
+	var err error
+	s := captured(func() { err = ChkErrListE([]error{nil, myErr, nil, panicErr}) })
+	if !errors.Is(err, myErr) || !errors.Is(err, panicErr) || err.Error() != "MyErr\nMyPanicErr" {
+		t.Errorf("joined error not as expected: %v", err)
+	}
+	if !strings.Contains(s, "MyErr") || !strings.Contains(s, "MyPanicErr") {
+		t.Errorf("ChkErrListE output not as expected: %q", s)
+	}
+}
+
+func TestUseStdLog(t *testing.T) {
+	var b strings.Builder
+	UseStdLog(log.New(&b, "log: ", 0))
+	Info("Info to log")
+	Error("Error to log")
+	TRC("TRC to log")
+	UseStdLog(nil)
+
+	lines := strings.Split(b.String(), "\n")
+	if len(lines) != 4 || lines[0] != "log: Info to log" || lines[1] != "log: Error to log" ||
+		!strings.HasPrefix(lines[2], "log: TRC @ ") || !strings.HasSuffix(lines[2], "TRC to log") || lines[3] != "" {
+		t.Errorf("log output not as expected: %q", b.String())
+	}
+}
+
+func TestChkErrListIndex(t *testing.T) {
+	l := Capture()
+	ChkErrList([]error{nil, myErr, nil, nil, panicErr})
+	l.Restore()
+
+	got := l.Lines()
+	if len(got) != 2 || !strings.HasSuffix(got[0], "[2/5] MyErr") || !strings.HasSuffix(got[1], "[5/5] MyPanicErr") {
+		t.Errorf("ChkErrList index not as expected: %q", got)
+	}
+}
+
+func TestIAmFull(t *testing.T) {
+	if nm := IAmFull(); nm != "github.com/jayacarlson/dbg.TestIAmFull" {
+		t.Errorf("IAmFull not as expected: %q", nm)
+	}
+	if nm := IAm(); nm != "TestIAmFull" {
+		t.Errorf("IAm not as expected: %q", nm)
+	}
+}
+
+func TestTree(t *testing.T) {
+	v := map[string]interface{}{
+		"a": 1,
+		"b": map[string]int{"c": 2, "d": 3},
+		"e": []string{"x"},
+	}
+	cyc := map[string]interface{}{"n": 1}
+	cyc["self"] = cyc
+
+	exp := `tree
+├── a: 1
+├── b
+│   ├── c: 2
+│   └── d: 3
+└── e
+    └── [0]: x
+cycle
+├── n: 1
+└── self: <cycle>
+`
+	if s := captured(func() { Tree("tree", v); Tree("cycle", cyc) }); s != exp {
+		t.Errorf("Tree not as expected:\n%s", s)
+	}
+}
+
+//go:noinline
+func callerInner() []string {
+	return []string{Caller(0), Caller(1), Caller(2), IAm(), IWas(), Caller(1000)}
+}
+
+//go:noinline
+func callerOuter() []string {
+	return callerInner()
+}
+
+func TestCaller(t *testing.T) {
+	exp := []string{"callerInner", "callerOuter", "TestCaller", "callerInner", "callerOuter", ""}
+	if got := callerOuter(); strings.Join(got, "|") != strings.Join(exp, "|") {
+		t.Errorf("Caller names not as expected: %q", got)
+	}
+}
+
+func TestLocationForLevel(t *testing.T) {
+	SetLocationForLevel(ErrLevel, true)
+	defer SetLocationForLevel(ErrLevel, false)
+	bug := Dbg{Enabled: true}
+
+	s, l := captured(func() { Info("info text") }), line()
+	if s != "info text\n" {
+		t.Errorf("Info should not show location: %q", s)
+	}
+	s, l = captured(func() { Error("error text") }), line()
+	if s != fmt.Sprintf("@ %d in "+testFile+"  error text\n", l) {
+		t.Errorf("Error should show location: %q", s)
+	}
+	s, l = captured(func() { bug.Error("bug error text") }), line()
+	if s != fmt.Sprintf("@ %d in "+testFile+"  bug error text\n", l) {
+		t.Errorf("Dbg.Error should show location: %q", s)
+	}
+}
+
+func recoverPanic() (r interface{}) {
+	defer func() {
+		r = CaptureRecover(recover())
+	}()
+	panic("boom")
+}
+
+func TestCaptureRecover(t *testing.T) {
+	var r interface{}
+	s := captured(func() { r = recoverPanic() })
+	if r != "boom" {
+		t.Errorf("CaptureRecover did not return panic value: %v", r)
+	}
+	if !strings.HasPrefix(s, "PANIC: boom\n") || !strings.Contains(s, "recoverPanic") {
+		t.Errorf("CaptureRecover output not as expected: %q", s)
+	}
+
+	s = captured(func() {
+		defer Recover()
+		panic("swallowed")
+	})
+	if !strings.HasPrefix(s, "PANIC: swallowed\n") {
+		t.Errorf("Recover output not as expected: %q", s)
+	}
+}
+
+func TestMaxOutConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	exits := 0
+	defer SetExitFunc(nil)
+	SetExitFunc(func(int) {
+		mu.Lock()
+		exits++
+		mu.Unlock()
+	})
+
+	bug := Dbg{Enabled: true}
+	bug.ResetMaxOut(50)
+	s := captured(func() {
+		var wg sync.WaitGroup
+		for g := 0; g < 10; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < 10; n++ {
+					bug.Echo("countdown")
+				}
+			}()
+		}
+		wg.Wait()
+	})
+	if exits != 1 {
+		t.Errorf("countdown exit called %d times", exits)
+	}
+	if strings.Count(s, "Countdown expired") != 1 {
+		t.Errorf("countdown expired not output once: %q", s)
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	clock := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	SetClock(func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	})
+	SetTimestamp("15:04:05")
+	defer SetClock(nil)
+	defer SetTimestamp("")
+
+	l := Capture()
+	Info("first")
+	defer Trace("traced")()
+	Info("second")
+	l.Restore()
+
+	exp := []string{"03:04:06 first", "03:04:07 --> traced", "03:04:09 second"}
+	got := l.Lines()
+	if len(got) != 3 || got[0] != exp[0] || !strings.HasPrefix(got[1], exp[1]) || got[2] != exp[2] {
+		t.Errorf("timestamps not as expected: %q", got)
+	}
+}
+
+func TestSetExitFunc(t *testing.T) {
+	codes := []int{}
+	SetExitFunc(func(c int) { codes = append(codes, c) })
+	defer SetExitFunc(nil)
+
+	captured(func() {
+		Fatal("Fatal")
+		FatalIf(true, "FatalIf")
+		FatalIf(false, "FatalIf false")
+		FatalIfErr(myErr, "FatalIfErr")
+		FatalIfErr(nil, "FatalIfErr nil")
+		FatalWrapIfErr(myErr, "FatalWrapIfErr")
+		ChkTruX(false, "ChkTruX")
+		ChkTruX(true, "ChkTruX true")
+		ChkErrX(myErr, "ChkErrX")
+		ChkErrX(nil, "ChkErrX nil")
+	})
+	if fmt.Sprint(codes) != "[-1 -1 -1 -1 -1 -1]" {
+		t.Errorf("exit codes not as expected: %v", codes)
+	}
+}
+
+func TestStrictFormat(t *testing.T) {
+	SetStrictFormat(true)
+	defer SetStrictFormat(false)
+
+	c := Capture()
+	Info("good %d", 1)
+	Info("missing %d")
+	l := line() - 1
+	Info("literal %s %%!", "%!d(")
+	Info("extra", 1)
+	Info("wrong %d", "type")
+	c.Restore()
+
+	got := c.Lines()
+	if len(got) != 8 || got[1] != "missing %!d(MISSING)" ||
+		got[2] != fmt.Sprintf("FMT @ %d in "+testFile+"  format verbs & args mismatch", l) ||
+		got[3] != "literal %!d( %!" || !strings.Contains(got[5], "FMT @") || !strings.HasPrefix(got[7], "FMT @") {
+		t.Errorf("strict format output not as expected: %q", got)
+	}
+}
+
+func TestSetExitCode(t *testing.T) {
+	codes := []int{}
+	SetExitFunc(func(c int) { codes = append(codes, c) })
+	SetExitCode(2)
+	defer SetExitFunc(nil)
+	defer SetExitCode(-1)
+
+	bug := Dbg{Enabled: true, MaxOut: 1}
+	captured(func() {
+		Fatal("Fatal")
+		ChkErrX(myErr, "ChkErrX")
+		bug.Echo("countdown")
+	})
+	if fmt.Sprint(codes) != "[2 2 2]" {
+		t.Errorf("exit codes not as expected: %v", codes)
+	}
+}
+
+// writer that fails after a number of writes
+type flakyWriter struct {
+	buf   *strings.Builder
+	fails int
+}
+
+func (f *flakyWriter) Close() error { return nil }
+func (f *flakyWriter) Write(p []byte) (int, error) {
+	if f.fails--; 0 == f.fails {
+		return 0, errors.New("connection dropped")
+	}
+	return f.buf.Write(p)
+}
+
+func TestResilientOutput(t *testing.T) {
+	clock := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	SetClock(func() time.Time { return clock })
+	defer SetClock(nil)
+	var b strings.Builder
+	dials := 0
+	SetResilientOutput(func() (io.WriteCloser, error) {
+		if dials++; 2 == dials || 3 == dials {
+			return nil, errors.New("connection refused")
+		}
+		return &flakyWriter{buf: &b, fails: 2}, nil
+	})
+	defer SetOutput(nil)
+
+	Echo("line 1") // written
+	Echo("line 2") // write fails, redial fails, held
+	Echo("line 3") // redial not yet due, held
+	clock = clock.Add(minRedial)
+	Echo("line 4") // redial fails again, held
+	clock = clock.Add(minRedial)
+	Echo("line 5") // redial not yet due (wait doubled), held
+	clock = clock.Add(minRedial)
+	Echo("line 6") // redialed, written along with held lines
+	Echo("line 7") // write fails, redialed & written
+
+	if b.String() != "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\n" || 5 != dials {
+		t.Errorf("resilient output not as expected: %q (%d dials)", b.String(), dials)
+	}
+}
+
+func TestStripColor(t *testing.T) {
+	var b strings.Builder
+	SetOutput(&b)
+	defer SetOutput(nil)
+
+	Info("not a terminal")
+	SetStripColor(false)
+	Info("forced color")
+	if b.String() != "not a terminal\n"+curColors().info+"forced color"+curColors().norm+"\n" {
+		t.Errorf("color stripping not as expected: %q", b.String())
+	}
+}
+
+func TestAllStacks(t *testing.T) {
+	block := make(chan bool)
+	defer close(block)
+	for n := 0; n < 2; n++ {
+		go func() { <-block }()
+	}
+	runtime.Gosched()
+
+	s := captured(AllStacks)
+	if n := strings.Count(s, "goroutine "); n < 3 {
+		t.Errorf("expected at least 3 goroutines in stacks, found %d:\n%s", n, s)
+	}
+	if !strings.Contains(s, "[chan receive]") {
+		t.Errorf("blocked goroutines not in stacks:\n%s", s)
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	defer func(on bool) {
+		if on {
+			Color()
+		}
+	}(ColorEnabled())
+
+	NoColor()
+	if ColorEnabled() {
+		t.Error("ColorEnabled true after NoColor")
+	}
+	Color()
+	if !ColorEnabled() {
+		t.Error("ColorEnabled false after Color")
+	}
+	NoColor()
+}
+
+func TestFieldsKV(t *testing.T) {
+	l := Capture()
+	InfoKV("event occurred", F("user", 42), F("attempt", 3))
+	WarningKV("slow", F("name", "two words"), F("ok", true))
+	ErrorKV("failed", F("err", myErr))
+	l.Restore()
+
+	exp := []string{`event occurred user=42 attempt=3`, `slow name="two words" ok=true`, `failed err=MyErr`}
+	if got := l.Lines(); strings.Join(got, "|") != strings.Join(exp, "|") {
+		t.Errorf("KV output not as expected: %q", got)
+	}
+}
+
+func TestDumpHandler(t *testing.T) {
+	if "windows" == runtime.GOOS {
+		t.Skip("can't signal self on windows")
+	}
+	EnableRingBuffer(5)
+	defer EnableRingBuffer(0)
+	captured(func() { Info("in the ring") })
+
+	c := Capture()
+	defer c.Restore()
+	InstallDumpHandler(os.Interrupt)
+	defer UninstallDumpHandler()
+
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(os.Interrupt)
+	for n := 0; n < 200 && !strings.Contains(c.String(), "in the ring"); n++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s := c.String()
+	if !strings.Contains(s, "STATE DUMP") || !strings.Contains(s, "goroutine ") ||
+		!strings.Contains(s, "MemStats: ") || !strings.Contains(s, "in the ring") {
+		t.Errorf("state dump not as expected:\n%s", s)
+	}
+}
+
+func TestEnum(t *testing.T) {
+	RegisterEnum("State", map[int]string{0: "IDLE", 1: "RUNNING", 2: "DONE"})
+	for _, c := range []struct {
+		typ  string
+		v    int
+		want string
+	}{
+		{"State", 1, "State(RUNNING)"},
+		{"State", 2, "State(DONE)"},
+		{"State", 7, "State(7)"},
+		{"Mode", 1, "Mode(1)"},
+	} {
+		if s := Enum(c.typ, c.v); s != c.want {
+			t.Errorf("Enum(%q, %d) = %q, want %q", c.typ, c.v, s, c.want)
+		}
+	}
+}
+
+func TestSetPrefix(t *testing.T) {
+	SetPrefix("[auth]")
+	defer SetPrefix("")
+	SetTimestamp("15:04")
+	defer SetTimestamp("")
+	SetClock(func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) })
+	defer SetClock(nil)
+
+	c := Capture()
+	c.KeepColor = true
+	Info("hello")
+	TRC("traced")
+	ChkTru(false, "checked")
+	ln := line() - 1
+	c.Restore()
+
+	lines := c.Lines()
+	if 3 != len(lines) {
+		t.Fatalf("expected 3 lines, got %q", lines)
+	}
+	if lines[0] != "03:04 [auth] "+curColors().info+"hello"+curColors().norm {
+		t.Errorf("prefix not between timestamp & color: %q", lines[0])
+	}
+	for n, want := range []string{
+		fmt.Sprintf("03:04 [auth] TRC @ %d in "+testFile, ln-1),
+		fmt.Sprintf("03:04 [auth] CHK @ %d in "+testFile, ln),
+	} {
+		if !strings.HasPrefix(stripColor(lines[n+1]), want) {
+			t.Errorf("line %d: expected prefix %q, got %q", n+1, want, stripColor(lines[n+1]))
+		}
+	}
+
+	SetPrefix("")
+	if s := captured(func() { Info("hello") }); !strings.HasPrefix(s, "03:04 hello") {
+		t.Errorf("prefix not cleared: %q", s)
+	}
+}
+
+type layerErr struct{ e error }
+
+func (l layerErr) Error() string { return "layer (" + l.e.Error() + ")" }
+func (l layerErr) Unwrap() error { return l.e }
+
+func TestErrSummary(t *testing.T) {
+	inner := errors.New("inner")
+	e := fmt.Errorf("outer: %w", fmt.Errorf("middle: %w", inner))
+	if s := ErrSummary(e); s != "outer: middle: inner" {
+		t.Errorf("summary of wrapped error: %q", s)
+	}
+	if s := ErrSummary(fmt.Errorf("top: %w", layerErr{inner})); s != "top: layer (inner): inner" {
+		t.Errorf("summary of custom wrapping error: %q", s)
+	}
+	if s := ErrSummary(inner); s != "inner" {
+		t.Errorf("summary of single error: %q", s)
+	}
+	if s := ErrSummary(nil); s != "" {
+		t.Errorf("summary of nil error: %q", s)
+	}
+}
+
+func TestPrefixEachLine(t *testing.T) {
+	SetPrefix("[auth]")
+	defer SetPrefix("")
+	SetTimestamp("15:04")
+	defer SetTimestamp("")
+	SetClock(func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) })
+	defer SetClock(nil)
+	EnableErrorNumbers(true)
+	defer EnableErrorNumbers(false)
+
+	s := captured(func() {
+		Info("one\ntwo")
+		Error("bad\nworse")
+		Indent()
+		Echo("in\nside")
+		Outdent()
+	})
+	want := "03:04 [auth] one\n03:04 [auth] two\n" +
+		"03:04 [auth] [#1] bad\n03:04 [auth] [#1] worse\n" +
+		"03:04 [auth]   in\n03:04 [auth]   side\n"
+	if s != want {
+		t.Errorf("expected every line prefixed %q, got %q", want, s)
+	}
+}
+
+func TestDbgPrefix(t *testing.T) {
+	SetPrefix("[app]")
+	defer SetPrefix("")
+	db := Dbg{Enabled: true, Prefix: "db"}
+	plain := Dbg{Enabled: true}
+
+	s := captured(func() {
+		db.Info("opened %d%%", 50)
+		db.ChkTru(false, "checked")
+		db.ChkErr(errors.New("failed"))
+		plain.Info("untagged")
+		(&Dbg{Enabled: true, Prefix: "100%"}).Warning("odd")
+	})
+	ln := line() - 7
+	want := fmt.Sprintf("[app] [db] opened 50%%\n"+
+		"[app] [db] CHK @ %d in "+testFile+"  checked\n"+
+		"[app] [db] ERR @ %d in "+testFile+"  failed\n"+
+		"[app] untagged\n"+
+		"[app] [100%%] odd\n", ln+2, ln+3)
+	if s != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, s)
+	}
+
+	SetExitFunc(func(int) {})
+	defer SetExitFunc(nil)
+	db.ResetMaxOut(1)
+	s = captured(func() {
+		db.TRC()
+		db.TRCFROM()
+		db.Trace("traced")()
+		db.StackTrace()
+		db.Echo("last")
+	})
+	for _, l := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		if !strings.HasPrefix(l, "[app] [db] ") {
+			t.Errorf("line not tagged: %q", l)
+		}
+	}
+	if !strings.Contains(s, "Countdown expired") {
+		t.Errorf("countdown didn't expire:\n%s", s)
+	}
+}
+
+func TestDbgStackTrace(t *testing.T) {
+	bug := Dbg{}
+	if s := captured(func() { bug.StackTrace() }); "" != s {
+		t.Errorf("disabled StackTrace output: %q", s)
+	}
+	bug.Enabled = true
+	s := captured(func() { bug.StackTrace() })
+	if !strings.HasPrefix(s, "Depth: ") || !strings.Contains(s, "Func: github.com/jayacarlson/dbg.TestDbgStackTrace.func2 - ") {
+		t.Errorf("enabled StackTrace output not as expected:\n%s", s)
+	}
+	if strings.Contains(s, "runtime.Callers") || strings.Contains(s, "dbg.stackTrace") || strings.Contains(s, "Dbg.StackTrace") {
+		t.Errorf("StackTrace output includes its own frames:\n%s", s)
+	}
+}
+
+func TestInfoProb(t *testing.T) {
+	count := func(p float64) int {
+		return len(strings.Split(captured(func() {
+			for n := 0; n < 100; n++ {
+				InfoProb(p, "sampled %d", n)
+			}
+		}), "\n")) - 1
+	}
+	SetSampleSeed(1)
+	if n := count(1); 100 != n {
+		t.Errorf("p=1 output %d of 100 lines", n)
+	}
+	if n := count(0); 0 != n {
+		t.Errorf("p=0 output %d of 100 lines", n)
+	}
+	SetSampleSeed(42)
+	half := count(0.5)
+	SetSampleSeed(42)
+	if n := count(0.5); n != half || n < 20 || n > 80 {
+		t.Errorf("p=0.5 with the same seed output %d then %d of 100 lines", half, n)
+	}
+}
+
+func TestRate(t *testing.T) {
+	rateMu.Lock()
+	rateLasts = map[string]rateSample{}
+	rateMu.Unlock()
+
+	t0 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := t0
+	SetClock(func() time.Time { return clock })
+	defer SetClock(nil)
+
+	s := captured(func() {
+		Rate("reqs", 100)
+		clock = t0.Add(2 * time.Second)
+		Rate("reqs", 350)
+		Rate("other", 5)
+	})
+	ln := line() - 5
+	want := fmt.Sprintf("RAT @ %d in "+testFile+"  reqs: 100 (first sample)\n"+
+		"RAT @ %d in "+testFile+"  reqs: 350 (+250 in 2s, 125.0/s)\n"+
+		"RAT @ %d in "+testFile+"  other: 5 (first sample)\n", ln, ln+2, ln+3)
+	if s != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, s)
+	}
+}
+
+//go:noinline
+func stackInner() []Frame {
+	return CaptureStack(5, 0)
+}
+
+//go:noinline
+func stackOuter() []Frame {
+	return stackInner()
+}
+
+func TestCaptureStack(t *testing.T) {
+	fs := stackOuter()
+	ln := line() - 1
+	if 3 > len(fs) || 5 < len(fs) {
+		t.Fatalf("expected 3 to 5 frames, got %d", len(fs))
+	}
+	for n, want := range []string{"stackInner", "stackOuter", "TestCaptureStack"} {
+		if fs[n].Func != "github.com/jayacarlson/dbg."+want {
+			t.Errorf("frame %d is %s, expected %s", n, fs[n].Func, want)
+		}
+	}
+	if fs[2].Line != ln || !strings.HasSuffix(fs[2].File, "dbg_test.go") || fs[2].Dir != dbgDir {
+		t.Errorf("frame location not as expected: %+v", fs[2])
+	}
+	if fs := CaptureStack(5, 1); fs[0].Func == "github.com/jayacarlson/dbg.TestCaptureStack" {
+		t.Errorf("skip of 1 didn't skip the caller")
+	}
+	if s := StackString(); !strings.HasPrefix(s, "Func: github.com/jayacarlson/dbg.TestCaptureStack - ") {
+		t.Errorf("StackString not as expected:\n%s", s)
+	}
+}
+
+func TestNonZero(t *testing.T) {
+	type pt struct{ X, Y int }
+	var np *pt
+	var ne error
+	s := captured(func() {
+		for _, v := range []interface{}{0, "", false, 0.0, pt{}, np, ne, []int(nil), map[string]int(nil), [2]int{}} {
+			NonZero("zero", v)
+		}
+		NonZero("int", 5)
+		NonZero("str", "hi")
+		NonZero("bool", true)
+		NonZero("pt", pt{Y: 2})
+		NonZero("slice", []int{})
+		NonZero("arr", [2]int{0, 1})
+	})
+	ln := line() - 7
+	want := ""
+	for n, v := range []string{"int: 5", "str: hi", "bool: true", "pt: {X:0 Y:2}", "slice: []", "arr: [0 1]"} {
+		want += fmt.Sprintf("VAL @ %d in "+testFile+"  %s\n", ln+n, v)
+	}
+	if s != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, s)
+	}
+}
+
+func TestChkErrR(t *testing.T) {
+	var err error
+	s := captured(func() { err = ChkErrR(myErr, "opening %s", "file") })
+	ln := line() - 1
+	if err != myErr {
+		t.Errorf("ChkErrR returned %v, expected %v", err, myErr)
+	}
+	if want := fmt.Sprintf("ERR @ %d in "+testFile+"  opening file\n", ln); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+	if s := captured(func() { err = ChkErrR(nil, "quiet") }); nil != err || "" != s {
+		t.Errorf("ChkErrR(nil) returned %v, output %q", err, s)
+	}
+}
+
+type ctxKey string
+
+func TestSetBaseContext(t *testing.T) {
+	SetContextFields(func(ctx context.Context) []Field {
+		if id, ok := ctx.Value(ctxKey("id")).(string); ok {
+			return []Field{F("req", id)}
+		}
+		return nil
+	})
+	defer SetContextFields(nil)
+	SetBaseContext(context.WithValue(context.Background(), ctxKey("id"), "abc123"))
+	defer SetBaseContext(nil)
+
+	if s := captured(func() { Info("handled"); Echo("part") }); s != "handled req=abc123\npart req=abc123\n" {
+		t.Errorf("base context fields not added: %q", s)
+	}
+	SetBaseContext(context.Background())
+	if s := captured(func() { Info("handled") }); s != "handled\n" {
+		t.Errorf("fields added without an ID: %q", s)
+	}
+
+	ctx := context.WithValue(context.Background(), ctxKey("id"), "abc123")
+	SetBaseContext(ctx)
+	if s := captured(func() { InfoCtx(context.WithValue(ctx, ctxKey("user"), "bob"), "derived") }); s != "derived req=abc123\n" {
+		t.Errorf("base context fields repeated: %q", s)
+	}
+
+	extracting := false
+	SetContextFields(func(ctx context.Context) []Field {
+		if !extracting {
+			extracting = true
+			Status("extracting")
+			extracting = false
+		}
+		return []Field{F("req", ctx.Value(ctxKey("id")))}
+	})
+	done := make(chan string)
+	go func() { done <- captured(func() { Info("handled") }) }()
+	select {
+	case s := <-done:
+		if s != "extracting req=abc123\nhandled req=abc123\n" {
+			t.Errorf("output from the context extractor not as expected: %q", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("output from the context extractor deadlocked")
+	}
+}
+
+func TestChecklist(t *testing.T) {
+	if !ColorEnabled() {
+		Color()
+		defer NoColor()
+	}
+	items := map[string]bool{"config": true, "db": false, "cache": true}
+	c := Capture()
+	c.KeepColor = true
+	Checklist(items)
+	c.Restore()
+	want := curColors().info + "✓" + curColors().norm + " cache\n" +
+		curColors().info + "✓" + curColors().norm + " config\n" +
+		curColors().err + "✗" + curColors().norm + " db\n"
+	if s := c.String(); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+
+	NoColor()
+	s := captured(func() { ChecklistOrdered([]string{"db", "config", "net"}, items) })
+	Color()
+	if want := "[XX] db\n[OK] config\n[XX] net <missing>\n"; s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestSetShowCaller(t *testing.T) {
+	SetShowCaller(true)
+	defer SetShowCaller(false)
+	bug := Dbg{Enabled: true}
+	dlvl := DbgLvl{Level: 5}
+	dmsk := DbgMsk{Mask: 0x8}
+
+	lines := strings.Split(captured(func() {
+		Info("info")
+		Warning("warning")
+		WARNING("block")
+		bug.Info("bug")
+		dlvl.Info(1, "lvl")
+		dmsk.Info(0x8, "msk")
+		InfoKV("kv", F("k", 1))
+		Persist(NoteLevel, "persist")
+		Ordered(InfoLevel, "ordered", nil, nil)
+		InfoProb(1, "prob")
+		Error("error")
+	}), "\n")
+	ln := line() - 12
+	if 12 != len(lines) {
+		t.Fatalf("expected 11 lines, got %d", len(lines)-1)
+	}
+	for n, l := range lines[:11] {
+		if want := fmt.Sprintf("@ %d in "+testFile+"  ", ln+n); !strings.HasPrefix(l, want) {
+			t.Errorf("expected %q to start with %q", l, want)
+		}
+	}
+
+	SetShowCaller(false)
+	if s := captured(func() { Info("info") }); s != "info\n" {
+		t.Errorf("location still shown: %q", s)
+	}
+}
+
+func TestEnableHostname(t *testing.T) {
+	h, err := os.Hostname()
+	if nil != err {
+		t.Skip("no hostname:", err)
+	}
+	h = strings.SplitN(h, ".", 2)[0]
+	EnableHostname(true)
+	SetPrefix("[app]")
+	s := captured(func() { Info("hello") })
+	SetPrefix("")
+	EnableHostname(false)
+	if want := h + " [app] hello\n"; s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+	if s := captured(func() { Info("hello") }); s != "hello\n" {
+		t.Errorf("hostname not removed: %q", s)
+	}
+}
+
+func TestWithWriter(t *testing.T) {
+	var outer, inner strings.Builder
+	c := Capture()
+	defer c.Restore()
+
+	func() {
+		defer WithWriter(&outer)()
+		Info("outer 1")
+		func() {
+			defer func() { recover() }()
+			defer WithWriter(&inner)()
+			Error("inner")
+			panic("restores anyway")
+		}()
+		Error("outer 2")
+	}()
+	Info("captured")
+
+	if s := outer.String(); s != "outer 1\nouter 2\n" {
+		t.Errorf("outer writer got %q", s)
+	}
+	if s := inner.String(); s != "inner\n" {
+		t.Errorf("inner writer got %q", s)
+	}
+	if s := c.String(); s != "captured\n" {
+		t.Errorf("output not restored, got %q", s)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	SetFormat(FormatJSON)
+	defer SetFormat(FormatText)
+	SetClock(func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) })
+	defer SetClock(nil)
+
+	c := Capture()
+	c.KeepColor = true
+	Info("said \"hi\" <&>")
+	Error("line 1\nline 2")
+	ln := line() - 2
+	c.Restore()
+
+	want := fmt.Sprintf(`{"level":"info","time":"2020-01-02T03:04:05Z","msg":"said \"hi\" <&>","caller":"`+testFile+`:%d"}`+"\n"+
+		`{"level":"error","time":"2020-01-02T03:04:05Z","msg":"line 1\nline 2","caller":"`+testFile+`:%d"}`+"\n", ln, ln+1)
+	if s := c.String(); s != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, s)
+	}
+	for _, l := range c.Lines() {
+		var m map[string]string
+		if err := json.Unmarshal([]byte(l), &m); nil != err {
+			t.Errorf("invalid JSON %q: %v", l, err)
+		}
+	}
+}
+
+func TestHead(t *testing.T) {
+	big := make([]int, 100)
+	for n := range big {
+		big[n] = n * 10
+	}
+	s := captured(func() {
+		Head("big", big, 5)
+		Head("map", map[string]int{"c": 3, "a": 1, "b": 2}, 2)
+		Head("few", &[2]string{"x", "y"}, 5)
+	})
+	ln := line() - 4
+	want := fmt.Sprintf("HED @ %d in "+testFile+"  big: [0 10 20 30 40 ...(+95 more)]\n"+
+		"HED @ %d in "+testFile+"  map: [a:1 b:2 ...(+1 more)]\n"+
+		"HED @ %d in "+testFile+"  few: [x y]\n", ln, ln+1, ln+2)
+	if s != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, s)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	c := Capture()
+	c.KeepColor = true
+	DiffLines([]string{"a", "b", "c", "d"}, []string{"a", "c", "x", "d", "e"})
+	c.Restore()
+	want := "  a\n" +
+		curColors().err + "- b" + curColors().norm + "\n" +
+		"  c\n" +
+		curColors().info + "+ x" + curColors().norm + "\n" +
+		"  d\n" +
+		curColors().info + "+ e" + curColors().norm + "\n"
+	if s := c.String(); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestFormatLogfmt(t *testing.T) {
+	SetFormat(FormatLogfmt)
+	defer SetFormat(FormatText)
+	SetClock(func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) })
+	defer SetClock(nil)
+
+	c := Capture()
+	c.KeepColor = true
+	Info("plain")
+	Warning(`said "hi"`)
+	Error("a=b\nc")
+	ln := line() - 3
+	c.Restore()
+
+	want := fmt.Sprintf("level=info time=2020-01-02T03:04:05Z caller="+testFile+":%d msg=plain\n"+
+		"level=warning time=2020-01-02T03:04:05Z caller="+testFile+":%d msg=\"said \\\"hi\\\"\"\n"+
+		"level=error time=2020-01-02T03:04:05Z caller="+testFile+":%d msg=\"a=b\\nc\"\n", ln, ln+1, ln+2)
+	if s := c.String(); s != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, s)
+	}
+}
+
+func TestChkSorted(t *testing.T) {
+	good := []int{1, 2, 2, 5}
+	if s := captured(func() {
+		if ChkSorted(good, func(i, j int) bool { return good[i] < good[j] }) {
+			t.Error("sorted slice reported as unsorted")
+		}
+	}); "" != s {
+		t.Errorf("output for sorted slice: %q", s)
+	}
+
+	bad := []string{"a", "c", "b", "d"}
+	var res bool
+	s := captured(func() { res = ChkSorted(bad, func(i, j int) bool { return bad[i] < bad[j] }, "names") })
+	ln := line() - 1
+	if !res {
+		t.Error("unsorted slice not reported")
+	}
+	if want := fmt.Sprintf("CHK @ %d in "+testFile+"  names (index 2 out of order)\n", ln); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	t0 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := t0
+	SetClock(func() time.Time { return clock })
+	defer SetClock(nil)
+
+	c := Capture()
+	c.KeepColor = true
+	load := Start("load")
+	clock = t0.Add(time.Millisecond)
+	parse := Start("parse")
+	clock = t0.Add(1500 * time.Microsecond)
+	load.Lap("read")
+	clock = t0.Add(3 * time.Millisecond)
+	parse.Stop()
+	load.Stop()
+	c.Restore()
+
+	want := curColors().stat + "load: read at 1.5ms" + curColors().norm + "\n" +
+		curColors().stat + "parse took 2ms" + curColors().norm + "\n" +
+		curColors().stat + "load took 3ms" + curColors().norm + "\n"
+	if s := c.String(); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	c := Capture()
+	var wg sync.WaitGroup
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			h := NewBuffer()
+			for n := 0; n < 20; n++ {
+				h.Info("req %d line %d", r, n)
+				Echo("unbuffered %d", r)
+			}
+			h.Flush()
+		}(r)
+	}
+	wg.Wait()
+	c.Restore()
+
+	lines, blocks := c.Lines(), 0
+	for n, l := range lines {
+		var r int
+		if _, err := fmt.Sscanf(l, "req %d line 0", &r); nil != err {
+			continue
+		}
+		blocks++
+		for i := 0; i < 20; i++ {
+			if want := fmt.Sprintf("req %d line %d", r, i); n+i >= len(lines) || lines[n+i] != want {
+				t.Fatalf("buffered output interleaved at line %d, expected %q", n+i, want)
+			}
+		}
+	}
+	if 8 != blocks {
+		t.Errorf("expected 8 buffered blocks, got %d", blocks)
+	}
+
+	h := NewBuffer()
+	h.Info("info")
+	h.Error("error")
+	h.Warning("warning")
+	if s := captured(h.FlushSorted); s != "error\nwarning\ninfo\n" {
+		t.Errorf("sorted flush not as expected: %q", s)
+	}
+	if s := captured(h.Flush); "" != s {
+		t.Errorf("buffer not emptied by flush: %q", s)
+	}
+}
+
+func TestCount(t *testing.T) {
+	ResetCounts()
+	defer ResetCounts()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				Count("cache-miss")
+				if 0 == n%10 {
+					Count("cache-evict")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s := captured(DumpCounts); s != "cache-evict: 40\ncache-miss: 400\n" {
+		t.Errorf("counts not as expected: %q", s)
+	}
+	ResetCounts()
+	if s := captured(DumpCounts); "" != s {
+		t.Errorf("counts not reset: %q", s)
+	}
+}
+
+func TestStructJSON(t *testing.T) {
+	type user struct {
+		ID       int    `json:"id"`
+		Name     string `json:"user_name,omitempty"`
+		Password string `json:"-"`
+		Admin    bool
+		secret   string
+	}
+	s := captured(func() { StructJSON("user", &user{5, "bob", "pw", true, "x"}) })
+	ln := line() - 1
+	if want := fmt.Sprintf("JSN @ %d in "+testFile+"  user: {id:5 user_name:bob Admin:true}\n", ln); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestTRCMinLevel(t *testing.T) {
+	if s := captured(func() { TRC("shown") }); !strings.Contains(s, "shown") {
+		t.Errorf("TRC not output by default: %q", s)
+	}
+	SetMinLevel(StatLevel)
+	defer SetMinLevel(EchoLevel)
+	bug := Dbg{Enabled: true}
+	s := captured(func() {
+		TRC("hidden")
+		TRCIF(true, "hidden")
+		TRCFROM("hidden")
+		bug.TRC("hidden")
+		Trace("hidden")()
+		Echo("hidden")
+		Status("status")
+	})
+	if s != "status\n" {
+		t.Errorf("TRC output not filtered: %q", s)
+	}
+}
+
+// reader that outputs while being read from, like output from another goroutine
+type chattyReader struct {
+	r      io.Reader
+	c      *Captured
+	during string // captured output while reading
+}
+
+func (cr *chattyReader) Read(p []byte) (int, error) {
+	Info("while waiting")
+	cr.during = cr.c.String()
+	return cr.r.Read(p)
+}
+
+type readFunc func(p []byte) (int, error)
+
+func (f readFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestPromptFatal(t *testing.T) {
+	c := Capture()
+	defer c.Restore()
+	var tb strings.Builder
+	AddTee(&tb, true)
+	defer RemoveTee(&tb)
+	var atExit, teed string
+	SetExitFunc(func(int) { atExit = c.String() })
+	defer SetExitFunc(nil)
+	stdin = bufio.NewReader(readFunc(func(p []byte) (int, error) {
+		Info("while waiting")
+		teed = tb.String()
+		Fatal("boom")
+		return copy(p, "y\n"), nil
+	}))
+	defer func() { stdin = bufio.NewReader(os.Stdin) }()
+
+	Prompt("Continue? ")
+	if "" != teed {
+		t.Errorf("tee output not held during prompt: %q", teed)
+	}
+	if atExit != "Continue? while waiting\nboom\n" {
+		t.Errorf("held output not flushed before exit: %q", atExit)
+	}
+	if s := tb.String(); s != "while waiting\nboom\n" {
+		t.Errorf("held tee output not as expected: %q", s)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	c := Capture()
+	defer c.Restore()
+	cr := &chattyReader{r: strings.NewReader("yes\r\nno\n"), c: c}
+	stdin = bufio.NewReader(cr)
+	defer func() { stdin = bufio.NewReader(os.Stdin) }()
+
+	if ans := Prompt("Continue? "); ans != "yes" {
+		t.Errorf("first answer %q", ans)
+	}
+	if cr.during != "Continue? " {
+		t.Errorf("output not held during prompt: %q", cr.during)
+	}
+	if s := c.String(); s != "Continue? while waiting\n" {
+		t.Errorf("held output not flushed after prompt: %q", s)
+	}
+	if ans := Prompt("Again? "); ans != "no" {
+		t.Errorf("second answer %q", ans)
+	}
+}
+
+func TestChkEq(t *testing.T) {
+	if s := captured(func() {
+		if ChkEq([]int{1, 2}, []int{1, 2}) {
+			t.Error("equal values reported as not equal")
+		}
+	}); "" != s {
+		t.Errorf("output for equal values: %q", s)
+	}
+
+	c := Capture()
+	c.KeepColor = true
+	ChkEq("hello world", "hello there world", "greeting")
+	ln := line() - 1
+	ChkEq("a\nB\nc", "a\nb\nc")
+	ChkEq(3, 4)
+	c.Restore()
+
+	want := fmt.Sprintf("%sCHK %s@ %d in "+testFile+"  %sgreeting\n", curColors().fail, curColors().norm+curColors().stat, ln, curColors().norm) +
+		"  hello " + curColors().err + "[-there -]" + curColors().norm + "world\n" +
+		fmt.Sprintf("%sCHK %s@ %d in "+testFile+"  %sNot equal\n", curColors().fail, curColors().norm+curColors().stat, ln+2, curColors().norm) +
+		"  a\n" + curColors().err + "- b" + curColors().norm + "\n" + curColors().info + "+ B" + curColors().norm + "\n  c\n" +
+		fmt.Sprintf("%sCHK %s@ %d in "+testFile+"  %sNot equal\n", curColors().fail, curColors().norm+curColors().stat, ln+3, curColors().norm) +
+		"  got=3\n  want=4\n"
+	if s := c.String(); s != want {
+		t.Errorf("expected:\n%q\ngot:\n%q", want, s)
+	}
+	if s := stripColor(inlineDiff("cat", "cut")); s != "c[-a-]{+u+}t" {
+		t.Errorf("inline diff %q", s)
+	}
+}
+
+func TestOnce(t *testing.T) {
+	ResetOnce()
+	defer ResetOnce()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	runs := 0
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Once("key", func() { mu.Lock(); runs++; mu.Unlock() })
+		}()
+	}
+	wg.Wait()
+	if 1 != runs {
+		t.Errorf("Once ran %d times", runs)
+	}
+
+	s := captured(func() {
+		for n := 0; n < 3; n++ {
+			WarningOnce("X is deprecated (%d)", n)
+			WarningOnce("Y is deprecated")
+		}
+	})
+	if s != "X is deprecated (0)\nY is deprecated\n" {
+		t.Errorf("WarningOnce output not as expected: %q", s)
+	}
+	ResetOnce()
+	if s := captured(func() { WarningOnce("Y is deprecated") }); s != "Y is deprecated\n" {
+		t.Errorf("WarningOnce not reset: %q", s)
+	}
+
+	SetMinLevel(CcnLevel)
+	s = captured(func() { WarningOnce("Z is deprecated") })
+	SetMinLevel(EchoLevel)
+	s += captured(func() { WarningOnce("Z is deprecated") })
+	if s != "Z is deprecated\n" {
+		t.Errorf("filtered WarningOnce used up its once: %q", s)
+	}
+	ResetOnce()
+}
+
+func TestInfoNth(t *testing.T) {
+	ResetOnce()
+	defer ResetOnce()
+	s := captured(func() {
+		for n := 1; n <= 5; n++ {
+			InfoNth(3, "iteration %d", n)
+			InfoNth(1, "other site %d", n)
+		}
+	})
+	if s != "other site 1\niteration 3\n" {
+		t.Errorf("InfoNth output not as expected: %q", s)
+	}
+	ResetOnce()
+	defer SetMinLevel(EchoLevel)
+	SetMinLevel(WarnLevel)
+	InfoNth(1, "filtered")
+	if 0 != len(nthCalls) {
+		t.Errorf("InfoNth counted calls while filtered: %v", nthCalls)
+	}
+}
+
+//go:noinline
+func deepError(n int) {
+	if n > 0 {
+		deepError(n - 1)
+		return
+	}
+	Error("deep")
+}
+
+func TestAutoStackDepth(t *testing.T) {
+	EnableAutoStack(true)
+	defer EnableAutoStack(false)
+	SetAutoStackDepth(3)
+	defer SetAutoStackDepth(5)
+
+	lines := strings.Split(captured(func() { deepError(10) }), "\n")
+	if 5 != len(lines) || "deep" != lines[0] || "" != lines[4] {
+		t.Fatalf("expected error & 3 frames, got %q", lines)
+	}
+	for _, l := range lines[1:4] {
+		if !strings.HasPrefix(l, "  Func: github.com/jayacarlson/dbg.deepError - ") {
+			t.Errorf("unexpected frame %q", l)
+		}
+	}
+	if s := captured(func() { Warning("warned") }); s != "warned\n" {
+		t.Errorf("stack added to warning: %q", s)
+	}
+	EnableAutoStack(false)
+	if s := captured(func() { deepError(2) }); s != "deep\n" {
+		t.Errorf("stack added when disabled: %q", s)
+	}
+}
+
+func TestSetTags(t *testing.T) {
+	SetTags("T>", "", "C>", "E>")
+	defer SetTags("TRC", "WAS", "CHK", "ERR")
+	s := captured(func() {
+		TRC("here")
+		TRCFROM("from")
+		ChkTru(false, "chk")
+		ChkErr(myErr)
+	})
+	ln := line() - 6
+	lines := strings.Split(s, "\n")
+	for n, want := range []string{
+		fmt.Sprintf("T> @ %d in "+testFile+"  here", ln+1),
+		"@ ",
+		fmt.Sprintf("C> @ %d in "+testFile+"  chk", ln+3),
+		fmt.Sprintf("E> @ %d in "+testFile+"  MyErr", ln+4),
+	} {
+		if !strings.HasPrefix(lines[n], want) {
+			t.Errorf("line %d: expected %q, got %q", n, want, lines[n])
+		}
+	}
+	SetTags("TRC", "WAS", "CHK", "ERR")
+	if s := captured(func() { TRC() }); !strings.HasPrefix(s, "TRC @ ") {
+		t.Errorf("tags not restored: %q", s)
+	}
+}
+
+func TestClip(t *testing.T) {
+	defer func(f func(string) error) { clipCopy = f }(clipCopy)
+	var copied []string
+	clipCopy = func(s string) error {
+		copied = append(copied, s)
+		return nil
+	}
+	if s := captured(func() { Clip("id=%d", 42) }); s != "id=42\n" {
+		t.Errorf("Clip output %q", s)
+	}
+	if 1 != len(copied) || "id=42" != copied[0] {
+		t.Errorf("Clip copied %q", copied)
+	}
+
+	clipCopy = func(string) error { return errors.New("no clipboard tool found") }
+	if s := captured(func() { Clip("value") }); s != "value\nClip: unable to copy to clipboard: no clipboard tool found\n" {
+		t.Errorf("Clip without a clipboard output %q", s)
+	}
+
+	copied = nil
+	clipCopy = func(s string) error {
+		copied = append(copied, s)
+		return nil
+	}
+	defer SetMinLevel(EchoLevel)
+	SetMinLevel(WarnLevel)
+	if s := captured(func() { Clip("hidden") }); "" != s || nil != copied {
+		t.Errorf("Clip output %q & copied %q while filtered", s, copied)
+	}
+}
+
+func TestSetColorRGB(t *testing.T) {
+	if !ColorEnabled() {
+		Color()
+		defer NoColor()
+	}
+	defer Color()
+	t.Setenv("COLORTERM", "")
+	if SetColorRGB(InfoLevel, 1, 2, 3) || curColors().info != "\033[32m" {
+		t.Errorf("truecolor used without support: %q", curColors().info)
+	}
+	t.Setenv("COLORTERM", "truecolor")
+	if !SetColorRGB(InfoLevel, 255, 128, 0) {
+		t.Error("truecolor not used")
+	}
+	c := Capture()
+	c.KeepColor = true
+	Info("themed")
+	c.Restore()
+	if s := c.String(); s != "\033[38;2;255;128;0mthemed\033[0m\n" {
+		t.Errorf("truecolor output %q", s)
+	}
+}
+
+func TestBadge(t *testing.T) {
+	if !ColorEnabled() {
+		Color()
+		defer NoColor()
+	}
+	SetBadgeColor("RETRY", "30;42")
+	defer SetBadgeColor("RETRY", "")
+
+	c := Capture()
+	c.KeepColor = true
+	Badge("DEPLOY", "to %s", "prod")
+	Badge("RETRY", "attempt %d", 2)
+	c.Restore()
+	want := "\033[30;46m DEPLOY " + curColors().norm + " to prod\n" +
+		"\033[30;42m RETRY " + curColors().norm + " attempt 2\n"
+	if s := c.String(); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+
+	NoColor()
+	s := captured(func() { Badge("100%", "done") })
+	Color()
+	if s != " 100% "+" done\n" {
+		t.Errorf("uncolored badge %q", s)
+	}
+}
+
+func TestColorRace(t *testing.T) {
+	if ColorEnabled() {
+		defer Color()
+	} else {
+		defer NoColor()
+	}
+	c := Capture()
+	c.KeepColor = true
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 200; n++ {
+			if 0 == n%2 {
+				NoColor()
+			} else {
+				Color()
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 200; n++ {
+			Info("info %d", n)
+			Warning("warning %d", n)
+		}
+	}()
+	wg.Wait()
+	c.Restore()
+	for _, l := range c.Lines() {
+		colored := strings.HasPrefix(l, "\033[")
+		if colored != strings.HasSuffix(l, "\033[0m") {
+			t.Errorf("colors mixed within a line: %q", l)
+		}
+	}
+}
+
+func TestChkTruf(t *testing.T) {
+	s := captured(func() {
+		ChkTru(false, "100% done")
+		ChkTru(false, "%d%% done", 50)
+		ChkTruf(false, "100%% done")
+		ChkErr(myErr, "at 5%")
+		ChkErrf(myErr, "at %d%%", 5)
+		ChkErrf(nil, "not output")
+	})
+	ln := line() - 7
+	want := fmt.Sprintf("CHK @ %d in "+testFile+"  100%% done\n"+
+		"CHK @ %d in "+testFile+"  50%% done\n"+
+		"CHK @ %d in "+testFile+"  100%% done\n"+
+		"ERR @ %d in "+testFile+"  at 5%%\n"+
+		"ERR @ %d in "+testFile+"  at 5%%\n", ln, ln+1, ln+2, ln+3, ln+4)
+	if s != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, s)
+	}
+}
+
+func TestFormatArgs(t *testing.T) {
+	for _, c := range []struct {
+		args []interface{}
+		want string
+	}{
+		{nil, "Check failed"},
+		{[]interface{}{"100%"}, "100%"},
+		{[]interface{}{"n=%d", 5}, "n=5"},
+		{[]interface{}{myErr}, "MyErr"},
+		{[]interface{}{myErr, " at %d", 7}, "MyErr at 7"},
+		{[]interface{}{42}, "Check failed"},
+	} {
+		if s := FormatArgs(c.args...); s != c.want {
+			t.Errorf("FormatArgs(%v) = %q, want %q", c.args, s, c.want)
+		}
+	}
+}
+
+func TestInfoCtx(t *testing.T) {
+	WithContextExtractor("req", ctxKey("id"))
+	defer func() { ctxKeys = nil }()
+	SetContextFields(func(ctx context.Context) []Field {
+		if u, ok := ctx.Value(ctxKey("user")).(string); ok {
+			return []Field{F("user", u)}
+		}
+		return nil
+	})
+	defer SetContextFields(nil)
+
+	ctx := context.WithValue(context.Background(), ctxKey("id"), "abc123")
+	s := captured(func() {
+		InfoCtx(ctx, "handled %d", 1)
+		ErrorCtx(context.WithValue(ctx, ctxKey("user"), "bob"), "failed")
+		WarningCtx(context.Background(), "no id")
+		Info("plain")
+	})
+	if want := "handled 1 req=abc123\nfailed req=abc123 user=bob\nno id\nplain\n"; s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+type syncer struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (s *syncer) Sync() error { s.syncs++; return nil }
+
+func TestFlush(t *testing.T) {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	restore := WithWriter(w)
+	Info("buffered")
+	if 0 != b.Len() {
+		t.Errorf("expected output held by the bufio.Writer, got %q", b.String())
+	}
+	if err := Flush(); nil != err {
+		t.Errorf("unexpected error: %v", err)
+	}
+	restore()
+	if !strings.Contains(b.String(), "buffered") {
+		t.Errorf("expected flushed output, got %q", b.String())
+	}
+
+	var s syncer
+	defer WithWriter(&s)()
+	defer SetExitFunc(nil)
+	SetExitFunc(func(int) {})
+	Fatal("gone")
+	if 0 == s.syncs || !strings.Contains(s.String(), "gone") {
+		t.Errorf("expected Fatal to sync its output, got %d syncs of %q", s.syncs, s.String())
+	}
+}
+
+func TestMaskNames(t *testing.T) {
+	RegisterMask("parser", 0x4)
+	RegisterMask("lexer", 0x8)
+	defer func() { delete(masks, "parser"); delete(masks, "lexer") }()
+
+	msk := DbgMsk{0x4}
+	s := captured(func() {
+		msk.InfoN("parser", "parsing %d", 1)
+		msk.InfoN("lexer", "lexing")
+		msk.InfoN("unknown", "never")
+		msk.Enable("lexer")
+		msk.Disable("parser")
+		msk.InfoN("parser", "parsing %d", 2)
+		msk.WarningN("lexer", "lexing")
+	})
+	if want := "parsing 1\nlexing\n"; s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+	if 0x8 != msk.Mask || !msk.Enabled("lexer") || msk.Enabled("parser") {
+		t.Errorf("expected only the lexer bit enabled, got %#x", msk.Mask)
+	}
+}
+
+func TestMaxWidth(t *testing.T) {
+	SetMaxWidth(20)
+	defer SetMaxWidth(0)
+	s := captured(func() {
+		Info("short line")
+		Info("this line is too long to fit so wraps")
+		Info("abcdefghijklmnopqrstuvwxyz")
+	})
+	want := "short line\nthis line is too\n    long to fit so\n    wraps\n" +
+		"abcdefghijklmnopqrst\n    uvwxyz\n"
+	if s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+	cs := &colorSet{info: "\033[32m", norm: "\033[0m"}
+	if got := wrapLine(cs.info+"this line is too long"+cs.norm, 20); "this line is too\n    long" != stripColor(got) {
+		t.Errorf("expected the color escapes not to count, got %q", got)
+	}
+}
+
+func TestSilence(t *testing.T) {
+	defer SetExitFunc(nil)
+	SetExitFunc(func(int) {})
+	s := captured(func() {
+		Silence()
+		defer Unsilence()
+		Info("silenced")
+		TRC("silenced")
+		Fatal("still output")
+	})
+	if !strings.Contains(s, "still output") || strings.Contains(s, "silenced") {
+		t.Errorf("expected only the Fatal output, got %q", s)
+	}
+	if s := captured(func() { Info("back") }); "back\n" != s {
+		t.Errorf("expected output after Unsilence, got %q", s)
+	}
+}
+
+func BenchmarkSilenced(b *testing.B) {
+	Silence()
+	defer Unsilence()
+	for n := 0; n < b.N; n++ {
+		Info("value %d of %s", n, "bench")
+	}
+}
+
+func BenchmarkDiscard(b *testing.B) {
+	defer WithWriter(io.Discard)()
+	for n := 0; n < b.N; n++ {
+		Info("value %d of %s", n, "bench")
+	}
+}
+
+type stackErr struct{ error }
+
+func (stackErr) StackTrace() []Frame {
+	return []Frame{{Func: "main.load", Line: 12, Dir: "cmd/load.go"}}
+}
+
+func TestErrorStack(t *testing.T) {
+	if s := captured(func() { ErrorStack(myErr) }); myErr.Error()+"\n" != s {
+		t.Errorf("expected a plain error output as Error, got %q", s)
+	}
+	e := fmt.Errorf("reading config: %w", errors.Join(stackErr{errors.New("open cfg")}, errors.New("bad perms")))
+	s := captured(func() { ErrorStack(e) })
+	want := "reading config\n" +
+		"    (2 errors)\n" +
+		"        open cfg\n" +
+		"          Func: main.load - 12   cmd/load.go\n" +
+		"        bad perms\n"
+	if s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestSample(t *testing.T) {
+	SetSample(4)
+	defer SetSample(0)
+	s := captured(func() {
+		for n := 0; n < 10; n++ {
+			Info("loop %d", n)
+			if 0 == n%2 {
+				Info("other %d", n)
+			}
+		}
+	})
+	want := "loop 0\nother 0\nloop 4 (sampled, 3 suppressed)\n" +
+		"loop 8 (sampled, 3 suppressed)\nother 8 (sampled, 3 suppressed)\n"
+	if s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestSetStream(t *testing.T) {
+	var out, errs []string
+	defer func(prev *settings) {
+		changeConfig(func(c *settings) { c.outSink, c.errSink = prev.outSink, prev.errSink })
+	}(curConfig())
+	changeConfig(func(c *settings) {
+		c.outSink = func(f string, a ...interface{}) { out = append(out, stripColor(fmt.Sprintf(f, a...))) }
+		c.errSink = func(f string, a ...interface{}) { errs = append(errs, stripColor(fmt.Sprintf(f, a...))) }
+	})
+
+	Danger("danger 1")
+	Error("error 1")
+	SetStream(DangerLevel, ErrStream)
+	SetStream(ErrLevel, OutStream)
+	Danger("danger 2")
+	Error("error 2")
+	SetStream(DangerLevel, DefaultStream)
+	SetStream(ErrLevel, DefaultStream)
+	Danger("danger 3")
+
+	if want := "danger 1\n,error 2\n,danger 3\n"; strings.Join(out, ",") != want {
+		t.Errorf("expected output %q, got %q", want, strings.Join(out, ","))
+	}
+	if want := "error 1\n,danger 2\n"; strings.Join(errs, ",") != want {
+		t.Errorf("expected error output %q, got %q", want, strings.Join(errs, ","))
+	}
+}
+
+func TestMust(t *testing.T) {
+	if v := Must(42, nil); 42 != v {
+		t.Errorf("expected 42, got %d", v)
+	}
+	var r interface{}
+	load := func() (string, error) { return "", myErr }
+	l := line() + 3
+	s := captured(func() {
+		defer func() { r = recover() }()
+		_ = Must(load())
+	})
+	if want := fmt.Sprintf("ERR @ %d in "+testFile+"  %s\n", l, myErr); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+	if e, ok := r.(error); !ok || !errors.Is(e, myErr) {
+		t.Errorf("expected a panic with the error, got %v", r)
+	}
+}
+
+func TestMustHaveAt(t *testing.T) {
+	var p *int
+	for _, tc := range []struct {
+		args []interface{}
+		want int
+	}{
+		{[]interface{}{1, "a", 2.0}, -1},
+		{[]interface{}{1, nil, nil}, 1},
+		{[]interface{}{1, 2, nil, "missing arg"}, 2},
+		{[]interface{}{nil, myErr}, 0},
+		{[]interface{}{"only"}, -1},
+		{[]interface{}{1, p}, 1}, // typed nil
+	} {
+		if got := MustHaveAt(tc.args...); got != tc.want {
+			t.Errorf("MustHaveAt(%v): expected %d, got %d", tc.args, tc.want, got)
+		}
+	}
+}
+
+type ptrErr struct{ msg string }
+
+func (e *ptrErr) Error() string { return e.msg }
+
+func TestTypedNil(t *testing.T) {
+	var p *int
+	var m map[string]int
+	var v interface{} = p
+	if nil == v || !isNil(v) || !isNil(m) || isNil(0) || isNil("") {
+		t.Errorf("expected only the nil pointer & map to be nil")
+	}
+	if nil == MustHave(1, p, "missing p") {
+		t.Errorf("expected MustHave to catch the typed nil")
+	}
+
+	load := func() error {
+		var e *ptrErr
+		return e // the classic mistake, a non-nil error
+	}
+	s := captured(func() { ChkErr(load()) })
+	if !strings.Contains(s, "typed nil error (*dbg.ptrErr)") {
+		t.Errorf("expected the typed nil error noted, got %q", s)
+	}
+}
+
+func TestDbgWriters(t *testing.T) {
+	var out, errs bytes.Buffer
+	d := Dbg{Enabled: true, Out: &out, Err: &errs}
+	l := line() + 4
+	s := captured(func() {
+		d.Info("info %d", 1)
+		d.Error("error %d", 2)
+		d.TRC("here")
+		d.ChkErr(myErr)
+		Info("global")
+	})
+	if "global\n" != s {
+		t.Errorf("expected only the global output, got %q", s)
+	}
+	if want := fmt.Sprintf("info 1\nTRC @ %d in "+testFile+"  here\n", l); out.String() != want {
+		t.Errorf("expected Out %q, got %q", want, out.String())
+	}
+	if want := fmt.Sprintf("error 2\nERR @ %d in "+testFile+"  %s\n", l+1, myErr); errs.String() != want {
+		t.Errorf("expected Err %q, got %q", want, errs.String())
+	}
+}
+
+func TestTRCV(t *testing.T) {
+	x, count := 5, 2
+	user := struct{ Name string }{"bob"}
+	l := line() + 1
+	s := captured(func() { TRCV(x, count+1, user) })
+	if want := fmt.Sprintf("TRC @ %d in "+testFile+"  x = 5  count+1 = 3  user = {Name:bob}\n", l); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+	if nil != callArgs("/no/such/file.go", 1, "TRCV", 1) {
+		t.Errorf("expected no args of an unreadable file")
+	}
+	vals := []interface{}{1, 2}
+	if s := captured(func() { TRCV(vals...) }); !strings.HasSuffix(s, "  [0] = 1  [1] = 2\n") {
+		t.Errorf("expected positional output, got %q", s)
+	}
+}
+
+func TestAutoNewline(t *testing.T) {
+	SetAutoNewline(false)
+	defer SetAutoNewline(true)
+	SetPrefix("app")
+	defer SetPrefix("")
+	s := captured(func() {
+		Info("found: ")
+		Error("%d errors", 3)
+		Echo("\n")
+		Echo("next")
+		Echo("\n")
+	})
+	if want := "app found: 3 errors\napp next\n"; s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestWarnErr(t *testing.T) {
+	l := line() + 2
+	s := captured(func() {
+		if !WarnErr(myErr) || WarnErr(nil) {
+			t.Errorf("expected WarnErr to return true only for an error")
+		}
+		d := Dbg{Enabled: true}
+		d.WarnErr(myErr, "retrying %d", 2)
+	})
+	want := fmt.Sprintf("WRN @ %d in "+testFile+"  %s\nWRN @ %d in "+testFile+"  retrying 2\n", l, myErr, l+4)
+	if s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	var walk func(n int)
+	walk = func(n int) {
+		defer Group(fmt.Sprintf("walk %d", n))()
+		Info("at %d", n)
+		if n > 0 {
+			walk(n - 1)
+		}
+	}
+	s := captured(func() {
+		walk(1)
+		Outdent() // not indented, does nothing
+		Info("done")
+		d := Dbg{Enabled: true, Prefix: "sub"}
+		end := d.Group("group")
+		ErrorStack(errors.New("two\nlines"))
+		end()
+		d.Prefix = "5%"
+		d.Group("odd")()
+	})
+	want := "walk 1\n  at 1\n  walk 0\n    at 0\ndone\n[sub] group\n  two; lines\n[5%] odd\n"
+	if s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+	Indent()
+	got := indented("a\nb\n")
+	Outdent()
+	if "  a\n  b\n" != got {
+		t.Errorf("expected each line indented, got %q", got)
+	}
+}
+
+func TestLocation(t *testing.T) {
+	l := line() + 1
+	file, ln, fn := Location(0)
+	if !strings.HasSuffix(file, "/dbg_test.go") || l != ln || !strings.HasSuffix(fn, ".TestLocation") {
+		t.Errorf("expected this location, got %s %d %s", file, ln, fn)
+	}
+	if _, _, fn := Location(1); "testing.tRunner" != fn {
+		t.Errorf("expected the testing caller, got %s", fn)
+	}
+	if file, ln, fn := Location(100); "" != file || 0 != ln || "" != fn {
+		t.Errorf("expected zero values past the top of the stack, got %s %d %s", file, ln, fn)
+	}
+	if f, ln := ErrAt(); testFile != f || l+10 != ln {
+		t.Errorf("expected ErrAt of this location, got %s %d", f, ln)
+	}
+}
+
+func TestColorTest(t *testing.T) {
+	lines := strings.Split(captured(ColorTest), "\n")
+	if len(lines) < 10 || "Echo     (normal) the quick brown fox" != lines[0] ||
+		"Danger   (white on red) the quick brown fox" != lines[9] {
+		t.Errorf("expected a line per level, got %q", lines)
+	}
+	SetMinLevel(ErrLevel)
+	defer SetMinLevel(EchoLevel)
+	if s := captured(ColorTest); "Error    (red) the quick brown fox\nDanger   (white on red) the quick brown fox\n" != s {
+		t.Errorf("expected only the active levels, got %q", s)
+	}
+}
+
+func TestBurst(t *testing.T) {
+	clock := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	SetClock(func() time.Time { return clock })
+	defer SetClock(nil)
+	SetBurst(2, time.Second)
+	defer SetBurst(0, 0)
+
+	s := captured(func() {
+		for n := 1; n <= 4; n++ {
+			Info("burst %d", n)
+		}
+		Danger("danger")
+		clock = clock.Add(1500 * time.Millisecond)
+		Info("refilled 1")
+		Info("throttled")
+		clock = clock.Add(time.Hour)
+		Info("refilled 2")
+		Info("refilled 3")
+		Info("throttled")
+	})
+	want := "burst 1\nburst 2\ndanger\n(throttled, 2 suppressed)\nrefilled 1\n(throttled, 1 suppressed)\nrefilled 2\nrefilled 3\n"
+	if s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestTee(t *testing.T) {
+	var plain, colored bytes.Buffer
+	AddTee(&plain, true)
+	AddTee(&colored, false)
+	defer ClearTees()
+	cs := &colorSet{info: "\033[32m", norm: "\033[0m"}
+	defer colors.Store(curColors())
+	colors.Store(cs)
+
+	s := captured(func() {
+		Info("both")
+		RemoveTee(&colored)
+		Info("plain only")
+	})
+	if "both\nplain only\n" != s {
+		t.Errorf("expected the normal output, got %q", s)
+	}
+	if "both\nplain only\n" != plain.String() {
+		t.Errorf("expected stripped tee output, got %q", plain.String())
+	}
+	if want := cs.info + "both" + cs.norm + "\n"; want != colored.String() {
+		t.Errorf("expected colored tee output %q, got %q", want, colored.String())
+	}
+}
+
+func TestTRCValues(t *testing.T) {
+	x, y := 3, []int{1, 2}
+	for _, tc := range []struct {
+		args []interface{}
+		want string
+	}{
+		{[]interface{}{"x is %d", x}, "x is 3"},
+		{[]interface{}{myErr}, myErr.Error()},
+		{[]interface{}{nil}, "nil"},
+		{[]interface{}{x}, "3"},
+		{[]interface{}{x, y, "z"}, "3 [1 2] z"},
+		{[]interface{}{myErr, x}, myErr.Error() + " 3"},
+		{[]interface{}{nil, x}, "<nil> 3"},
+	} {
+		if got := stripColor(trc(tc.args...)); got != tc.want {
+			t.Errorf("trc(%v): expected %q, got %q", tc.args, tc.want, got)
+		}
+	}
+	l := line() + 1
+	s := captured(func() { TRC(x, y) })
+	if want := fmt.Sprintf("TRC @ %d in "+testFile+"  3 [1 2]\n", l); s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestChkErrS(t *testing.T) {
+	SetChkStackDepth(2)
+	defer SetChkStackDepth(3)
+	l := line() + 1
+	s := captured(func() { ChkErrS(myErr, "loading") })
+	lines := strings.Split(s, "\n")
+	if 4 != len(lines) || fmt.Sprintf("ERR @ %d in "+testFile+"  loading", l) != lines[0] ||
+		!strings.HasPrefix(lines[1], "  Func: ") || !strings.Contains(lines[1], fmt.Sprintf("TestChkErrS.func1 - %d", l)) ||
+		!strings.Contains(lines[2], ".captured - ") {
+		t.Errorf("expected the error & 2 frames, got %q", lines)
+	}
+	if ChkErrS(nil) {
+		t.Errorf("expected false for a nil error")
+	}
+}
+
+func TestFailureHook(t *testing.T) {
+	var got []string
+	SetFailureHook(func(l Level, msg string) {
+		got = append(got, l.String()+": "+msg)
+		Error("from the hook") // mustn't call the hook again
+	})
+	defer SetFailureHook(nil)
+	l := line() + 4
+	captured(func() {
+		Info("not a failure")
+		Failed("failed %d", 1)
+		ChkErr(myErr)
+		WarnErr(myErr)
+	})
+	want := []string{"failed: failed 1", fmt.Sprintf("error: ERR @ %d in "+testFile+"  %s", l, myErr)}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestExpErrIs(t *testing.T) {
+	wrapped := fmt.Errorf("loading config: %w", myErr)
+	l := line() + 5
+	s := captured(func() {
+		if ExpErrIs(wrapped, myErr) || ExpErrIs(nil, nil) {
+			t.Errorf("expected the wrapped error to be found")
+		}
+		if !ExpErr(wrapped, myErr) || !ExpErrIs(wrapped, io.EOF) {
+			t.Errorf("expected ExpErr & a missing error to fail")
+		}
+	})
+	want := fmt.Sprintf("ERR @ %d in "+testFile+"  Expected error (%s) not given\n", l, myErr) +
+		fmt.Sprintf("ERR @ %d in "+testFile+"  Expected error (EOF) not in error chain (%s)\n", l, wrapped)
+	if s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestPanicError(t *testing.T) {
+	var r interface{}
+	l := line() + 3
+	func() {
+		defer func() { r = recover() }()
+		ChkTruP(false, "bad %s", "value")
+	}()
+	pe, ok := r.(*PanicError)
+	if !ok {
+		t.Fatalf("expected a *PanicError, got %T", r)
+	}
+	if "bad value" != pe.Error() || FailLevel != pe.Level || l != pe.Line ||
+		!strings.HasSuffix(pe.File, "dbg_test.go") || !strings.HasSuffix(pe.Func, "TestPanicError.func1") {
+		t.Errorf("unexpected panic value %+v", *pe)
+	}
+	var e error
+	func() {
+		defer func() { e, _ = recover().(error) }()
+		PanicIfErr(myErr)
+	}()
+	if !errors.As(e, &pe) || ErrLevel != pe.Level || myErr.Error() != e.Error() {
+		t.Errorf("expected an error level *PanicError, got %v", e)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	defer SetExitFunc(nil)
+	SetExitFunc(func(int) {})
+	s := captured(func() {
+		Info("before")
+		outer := Quiet()
+		inner := Quiet()
+		Info("quiet")
+		inner()
+		inner() // only undoes its own scope once
+		Error("still quiet")
+		Fatal("fatal")
+		outer()
+		Info("after")
+	})
+	if want := "before\nfatal\nafter\n"; s != want {
+		t.Errorf("expected %q, got %q", want, s)
+	}
+}
+
+func TestTaggedColors(t *testing.T) {
+	defer colors.Store(curColors())
+	Color()
+	cs := curColors()
+	c := Capture()
+	c.KeepColor = true
+	l := line() + 1
+	ChkTru(false, "failed check")
+	ChkErr(myErr)
+	NonZero("n", 1)
+	c.Restore()
+	loc := fmt.Sprintf("@ %d in "+testFile+"  ", l)
+	want := cs.fail + "CHK " + cs.norm + cs.stat + loc + cs.norm + "failed check\n" +
+		cs.err + "ERR " + cs.norm + cs.stat + fmt.Sprintf("@ %d in "+testFile+"  ", l+1) + cs.norm + myErr.Error() + "\n" +
+		cs.msg + "VAL " + cs.norm + cs.stat + fmt.Sprintf("@ %d in "+testFile+"  ", l+2) + cs.norm + cs.msg + "n" + cs.norm + ": 1\n"
+	if got := c.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestLongDiff(t *testing.T) {
+	long := strings.Repeat("abcdefghij", 2000)
+	if got := stripColor(inlineDiff(long+"x"+long, long+"y"+long)); got != long+"[-x-]{+y+}"+long {
+		t.Errorf("expected only the middle diffed, got %d runes", len(got))
+	}
+	a, b := strings.Repeat("ab", 1500), strings.Repeat("ba", 1500)
+	if d := eqDiff(a, b); !strings.HasPrefix(d, "  got=\"abab") || !strings.Contains(d, "\n  want=\"baba") {
+		t.Errorf("expected got= & want= for a diff too large, got %.40q", d)
+	}
+	var n int
+	diff(strings.Split(a, ""), strings.Split(b, ""), func(op byte, s string) { n++ })
+	if 6000 != n {
+		t.Errorf("expected all removed & added for a diff too large, got %d ops", n)
+	}
+}
+
+func TestSettingsConcurrent(t *testing.T) {
+	defer SetMinLevel(EchoLevel)
+	defer SetPrefix("")
+	defer SetLocationSeparator("  ")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 0; n < 100; n++ {
+			SetMinLevel(EchoLevel)
+			SetPrefix("[set]")
+			SetLocationSeparator(": ")
+			SetTags("TRC", "WAS", "CHK", "ERR")
+		}
+	}()
+	s := captured(func() {
+		for n := 0; n < 100; n++ {
+			Info("info")
+			TRC("trc")
+		}
+	})
+	<-done
+	if 200 != strings.Count(s, "\n") {
+		t.Errorf("expected 200 lines of output, got %q", s)
+	}
+}
+
+func TestStripColorPerWriter(t *testing.T) {
+	if !ColorEnabled() {
+		Color()
+		defer NoColor()
+	}
+	r, w, err := os.Pipe()
+	if nil != err {
+		t.Skip("no pipe:", err)
+	}
+	defer func(f *os.File) { os.Stdout = f }(os.Stdout)
+	os.Stdout = w
+	Info("piped")
+	w.Close()
+	if b, _ := io.ReadAll(r); "piped\n" != string(b) {
+		t.Errorf("color not stripped from output to a pipe: %q", b)
+	}
+
+	var out, routed strings.Builder
+	bug := Dbg{Enabled: true, Out: &out}
+	RouteLevel(NoteLevel, &routed)
+	defer RouteLevel(NoteLevel, nil)
+	bug.Info("own writer")
+	Note("routed")
+	SetStripColor(false)
+	defer SetOutput(nil)
+	bug.Info("kept")
+	Note("kept")
+	cs := curColors()
+	if want := "own writer\n" + cs.info + "kept" + cs.norm + "\n"; out.String() != want {
+		t.Errorf("expected Dbg writer output %q, got %q", want, out.String())
+	}
+	if want := "routed\n" + cs.note + "kept" + cs.norm + "\n"; routed.String() != want {
+		t.Errorf("expected routed output %q, got %q", want, routed.String())
+	}
+}
@@ -0,0 +1,82 @@
+package dbg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Output of messages with structured key/value fields
+
+// A key/value field of structured context for a message, see InfoKV
+type Field struct {
+	Key string
+	Val interface{}
+}
+
+// returns a key/value field for use with InfoKV, WarningKV & ErrorKV
+func F(key string, val interface{}) Field {
+	return Field{key, val}
+}
+
+// returns the field as key=value, the value formatted with %v and quoted if
+// it is a string containing spaces
+func (f Field) String() string {
+	cs := curColors()
+	v := fmt.Sprintf("%v", f.Val)
+	if _, ok := f.Val.(string); ok && strings.ContainsAny(v, " \t\n\"") {
+		v = strconv.Quote(v)
+	}
+	return cs.note + f.Key + cs.norm + "=" + v
+}
+
+// returns the fields as text to follow a message
+func fieldsText(fields []Field) string {
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(" " + f.String())
+	}
+	return b.String()
+}
+
+// green message followed by key=value fields to output
+func InfoKV(msg string, fields ...Field) {
+	cs := curColors()
+	if active(InfoLevel) {
+		output(InfoLevel, "%s\n", locFor(InfoLevel)+cs.info+msg+cs.norm+fieldsText(fields))
+	}
+}
+
+// orange message followed by key=value fields to output
+func WarningKV(msg string, fields ...Field) {
+	cs := curColors()
+	if active(WarnLevel) {
+		output(WarnLevel, "%s\n", locFor(WarnLevel)+cs.warn+msg+cs.norm+fieldsText(fields))
+	}
+}
+
+// red message followed by key=value fields to output
+func ErrorKV(msg string, fields ...Field) {
+	cs := curColors()
+	if active(ErrLevel) {
+		outerr(ErrLevel, "%s\n", locFor(ErrLevel)+cs.err+msg+cs.norm+fieldsText(fields))
+	}
+}
+
+// output the message followed by the values as key=value fields in the order
+// of the given keys, any key without a value is noted as missing
+func Ordered(l Level, msg string, keys []string, vals map[string]interface{}) {
+	if !active(l) {
+		return
+	}
+	cs := curColors()
+	var b strings.Builder
+	for _, k := range keys {
+		if v, ok := vals[k]; ok {
+			b.WriteString(" " + F(k, v).String())
+		} else {
+			b.WriteString(" " + cs.note + k + cs.norm + "=" + cs.warn + "<missing>" + cs.norm)
+		}
+	}
+	outlvl(l, "%s\n", locFor(l)+cs.level(l)+msg+cs.norm+b.String())
+}
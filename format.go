@@ -0,0 +1,83 @@
+package dbg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Machine readable output formats, see SetFormat
+
+// Format of output lines
+type Format int32
+
+const (
+	FormatText   Format = iota // colored text (the default)
+	FormatJSON                 // a JSON object per message: {"level","time","msg","caller"}
+	FormatLogfmt               // a logfmt line per message: level= time= caller= msg=
+)
+
+var format int32 // Format of output
+
+var levelNames = [...]string{"echo", "status", "note", "info", "message",
+	"warning", "caution", "failed", "error", "danger", "trace"}
+
+// set the format of output, FormatText (the default) or a machine readable
+// format where each message becomes a line with the level, time, message &
+// callers location -- without color
+func SetFormat(f Format) {
+	atomic.StoreInt32(&format, int32(f))
+}
+
+// returns the name of the level as used in the machine readable formats
+func (l Level) String() string {
+	if l >= 0 && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// returns the output text as a line in the given format, "" for no text
+func formatted(f Format, l Level, s string) string {
+	s = strings.TrimSuffix(stripColor(s), "\n")
+	if "" == s {
+		return ""
+	}
+	layout := curConfig().tsLayout
+	if "" == layout {
+		layout = time.RFC3339Nano
+	}
+	caller := ""
+	if _, file, line, ok := userCaller(); ok {
+		caller = fmt.Sprintf("%s:%d", shortName(file), line)
+	}
+	ts := now().Format(layout)
+	if FormatLogfmt == f {
+		return fmt.Sprintf("level=%s time=%s caller=%s msg=%s\n",
+			logfmtStr(l.String()), logfmtStr(ts), logfmtStr(caller), logfmtStr(s))
+	}
+	return fmt.Sprintf(`{"level":%s,"time":%s,"msg":%s,"caller":%s}`+"\n",
+		jsonStr(l.String()), jsonStr(ts), jsonStr(s), jsonStr(caller))
+}
+
+// returns the string as a logfmt value, quoted if empty or it contains spaces,
+// quotes, '=' or control characters
+func logfmtStr(s string) string {
+	if "" == s || strings.ContainsAny(s, " =\"\\") || strconv.Quote(s) != `"`+s+`"` {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// returns the string as a JSON string value
+func jsonStr(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
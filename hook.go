@@ -0,0 +1,59 @@
+package dbg
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A hook run on failure output, e.g. to count errors or notify a test harness
+
+var (
+	hookMu   sync.Mutex
+	failHook func(Level, string) // nil if none, see SetFailureHook
+	inHook   sync.Map            // ids of the goroutines running the hook
+)
+
+// set a func called after each line of failed, error or danger output (which
+// includes the failed checks) is output, given its level & uncolored text
+// (without the newline), nil removes it -- the func is called synchronously
+// by the goroutine that output the line, possibly by several at once, and
+// any output it does itself doesn't call it again -- any panic of the func
+// is the callers to deal with
+func SetFailureHook(fn func(l Level, msg string)) {
+	hookMu.Lock()
+	defer hookMu.Unlock()
+	failHook = fn
+}
+
+// call any failure hook for output text at a failed, error or danger level
+func callHook(l Level, s string) {
+	if l.rank() < FailLevel || "" == s {
+		return
+	}
+	hookMu.Lock()
+	fn := failHook
+	hookMu.Unlock()
+	if nil == fn {
+		return
+	}
+	id := goid()
+	if _, busy := inHook.LoadOrStore(id, true); busy {
+		return // output by the hook itself
+	}
+	defer inHook.Delete(id)
+	fn(l, strings.TrimSuffix(stripColor(s), "\n"))
+}
+
+// returns the id of the current goroutine, as shown in its stack trace
+func goid() uint64 {
+	buf := make([]byte, 64)
+	buf = bytes.TrimPrefix(buf[:runtime.Stack(buf, false)], []byte("goroutine "))
+	if n := bytes.IndexByte(buf, ' '); n > 0 {
+		buf = buf[:n]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
@@ -0,0 +1,70 @@
+package dbg
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// Indenting of output to show nesting, e.g. of recursive calls
+
+var indent int32 // depth of indenting of output lines, see Indent
+
+// indent all following output lines by another two spaces -- the depth is
+// global (not per goroutine), so indent only from a single goroutine at once
+func Indent() {
+	atomic.AddInt32(&indent, 1)
+}
+
+// undo an Indent, doing nothing if not indented
+func Outdent() {
+	for {
+		d := atomic.LoadInt32(&indent)
+		if d <= 0 || atomic.CompareAndSwapInt32(&indent, d, d-1) {
+			return
+		}
+	}
+}
+
+// output the name (cyan) then indent the following output, returning the func
+// to undo the indent -- use as:  defer dbg.Group("name")()
+func Group(name string) func() {
+	return group(output, name)
+}
+
+// use Dbg interface for Group
+func (d *Dbg) Group(name string) func() {
+	if d.Enabled {
+		return group(d.tagOutput, name)
+	}
+	return func() {}
+}
+
+func group(out outFunc, name string) func() {
+	if active(MsgLevel) {
+		cs := curColors()
+		out(MsgLevel, "%s\n", cs.msg+name+cs.norm)
+	}
+	Indent()
+	return Outdent
+}
+
+// returns the text with each of its lines indented by the current depth
+func indented(s string) string {
+	return leading(indentation(), s)
+}
+
+// returns the indentation for the current depth
+func indentation() string {
+	return strings.Repeat("  ", int(atomic.LoadInt32(&indent)))
+}
+
+// returns the text with lead put at the start of each of its lines
+func leading(lead, s string) string {
+	if "" == lead {
+		return s
+	}
+	if n := len(s) - 1; '\n' == s[n] {
+		return lead + strings.ReplaceAll(s[:n], "\n", "\n"+lead) + "\n"
+	}
+	return lead + strings.ReplaceAll(s, "\n", "\n"+lead)
+}
@@ -0,0 +1,424 @@
+package dbg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Helpers for inspecting values while debugging
+
+var (
+	enumMu sync.Mutex
+	enums  = map[string]map[int]string{} // names of values by type, see RegisterEnum
+)
+
+// output the len (and cap where applicable) of a slice, array, map, chan or
+// string along with the callers location
+func Size(label string, v interface{}) {
+	if !active(MsgLevel) {
+		return
+	}
+	cs := curColors()
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Ptr && !r.IsNil() {
+		r = r.Elem()
+	}
+	switch r.Kind() {
+	case reflect.Slice, reflect.Chan:
+		output(MsgLevel, "%s\n", tagged(cs, cs.msg, sizTag, at())+cs.msg+label+cs.norm+fmt.Sprintf(": len=%d cap=%d", r.Len(), r.Cap()))
+	case reflect.Array, reflect.Map, reflect.String:
+		output(MsgLevel, "%s\n", tagged(cs, cs.msg, sizTag, at())+cs.msg+label+cs.norm+fmt.Sprintf(": len=%d", r.Len()))
+	default:
+		output(MsgLevel, "%s\n", tagged(cs, cs.msg, sizTag, at())+cs.warn+label+": unsupported kind "+r.Kind().String()+cs.norm)
+	}
+}
+
+// output the first n elements of a slice or array (or the first n keys, in
+// sorted order, of a map) followed by a count of any more not output
+func Head(label string, v interface{}, n int) {
+	if !active(MsgLevel) {
+		return
+	}
+	cs := curColors()
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Ptr && !r.IsNil() {
+		r = r.Elem()
+	}
+	var elems []string
+	switch r.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < r.Len() && i < n; i++ {
+			elems = append(elems, fmt.Sprintf("%+v", r.Index(i)))
+		}
+	case reflect.Map:
+		mk := r.MapKeys()
+		sort.Slice(mk, func(i, j int) bool { return fmt.Sprint(mk[i]) < fmt.Sprint(mk[j]) })
+		for i := 0; i < len(mk) && i < n; i++ {
+			elems = append(elems, fmt.Sprintf("%v:%+v", mk[i], r.MapIndex(mk[i])))
+		}
+	default:
+		output(MsgLevel, "%s\n", tagged(cs, cs.msg, hedTag, at())+cs.warn+label+": unsupported kind "+r.Kind().String()+cs.norm)
+		return
+	}
+	if more := r.Len() - len(elems); more > 0 {
+		elems = append(elems, cs.stat+fmt.Sprintf("...(+%d more)", more)+cs.norm)
+	}
+	output(MsgLevel, "%s\n", tagged(cs, cs.msg, hedTag, at())+cs.msg+label+cs.norm+": ["+strings.Join(elems, " ")+"]")
+}
+
+// output the fields of a struct named by their json tag names (falling back
+// to the field name), so the output matches the wire format -- fields tagged
+// "-" and unexported fields are skipped
+func StructJSON(label string, v interface{}) {
+	if !active(MsgLevel) {
+		return
+	}
+	cs := curColors()
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Ptr && !r.IsNil() {
+		r = r.Elem()
+	}
+	if r.Kind() != reflect.Struct {
+		output(MsgLevel, "%s\n", tagged(cs, cs.msg, jsnTag, at())+cs.warn+label+": unsupported kind "+r.Kind().String()+cs.norm)
+		return
+	}
+	var fields []string
+	for i := 0; i < r.NumField(); i++ {
+		sf := r.Type().Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if "-" == name || "" != sf.PkgPath {
+			continue
+		}
+		if "" == name {
+			name = sf.Name
+		}
+		fields = append(fields, fmt.Sprintf("%s:%+v", name, r.Field(i)))
+	}
+	output(MsgLevel, "%s\n", tagged(cs, cs.msg, jsnTag, at())+cs.msg+label+cs.norm+": {"+strings.Join(fields, " ")+"}")
+}
+
+// output the value along with the callers location, but only if it is not the
+// zero value of its type (nil, 0, "", false, empty struct, ...)
+func NonZero(label string, v interface{}) {
+	if !active(MsgLevel) || nil == v || reflect.ValueOf(v).IsZero() {
+		return
+	}
+	cs := curColors()
+	output(MsgLevel, "%s\n", tagged(cs, cs.msg, valTag, at())+cs.msg+label+cs.norm+fmt.Sprintf(": %+v", v))
+}
+
+// output each item of the checklist (sorted by name) with a pass/fail mark, a
+// green ✓ or red ✗, or [OK]/[XX] when color is off
+func Checklist(items map[string]bool) {
+	names := make([]string, 0, len(items))
+	for nm := range items {
+		names = append(names, nm)
+	}
+	sort.Strings(names)
+	ChecklistOrdered(names, items)
+}
+
+// output the items of the checklist in the order of the given names, any name
+// without an item is marked as failed
+func ChecklistOrdered(names []string, items map[string]bool) {
+	if !active(MsgLevel) {
+		return
+	}
+	cs := curColors()
+	pass, fail := "[OK]", "[XX]"
+	if cs.on {
+		pass, fail = cs.info+"✓"+cs.norm, cs.err+"✗"+cs.norm
+	}
+	var b strings.Builder
+	for _, nm := range names {
+		ok, found := items[nm]
+		switch {
+		case !found:
+			b.WriteString(fail + " " + nm + " " + cs.warn + "<missing>" + cs.norm + "\n")
+		case ok:
+			b.WriteString(pass + " " + nm + "\n")
+		default:
+			b.WriteString(fail + " " + nm + "\n")
+		}
+	}
+	output(MsgLevel, "%s", b.String())
+}
+
+// output a line diff of a to b, lines only in a are output as "- line" (red),
+// lines only in b as "+ line" (green) & common lines as "  line"
+func DiffLines(a, b []string) {
+	if active(MsgLevel) {
+		output(MsgLevel, "%s", diffText(a, b))
+	}
+}
+
+// returns the colored line diff of a to b
+func diffText(a, b []string) string {
+	cs := curColors()
+	var d strings.Builder
+	diff(a, b, func(op byte, s string) {
+		switch op {
+		case '-':
+			d.WriteString(cs.err + "- " + s + cs.norm + "\n")
+		case '+':
+			d.WriteString(cs.info + "+ " + s + cs.norm + "\n")
+		default:
+			d.WriteString("  " + s + "\n")
+		}
+	})
+	return d.String()
+}
+
+// returns the colored rune diff of a to b on a single line, with removed text
+// shown as [-text-] (red) & added text as {+text+} (green)
+func inlineDiff(a, b string) string {
+	cs := curColors()
+	var d strings.Builder
+	last := byte(' ')
+	end := func() {
+		switch last {
+		case '-':
+			d.WriteString("-]" + cs.norm)
+		case '+':
+			d.WriteString("+}" + cs.norm)
+		}
+	}
+	diff(runeStrs(a), runeStrs(b), func(op byte, s string) {
+		if op != last {
+			end()
+			switch op {
+			case '-':
+				d.WriteString(cs.err + "[-")
+			case '+':
+				d.WriteString(cs.info + "{+")
+			}
+			last = op
+		}
+		d.WriteString(s)
+	})
+	end()
+	return d.String()
+}
+
+// most cells of the LCS table of a diff, larger diffs (after trimming any
+// common start & end) just show all of a as removed & all of b as added
+const maxDiffCells = 1 << 20
+
+// returns the number of elements a & b have in common at their start & end
+func trimCommon(a, b []string) (pre, suf int) {
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	return pre, suf
+}
+
+// returns true if the diff of a to b is too large to find via the LCS table
+func bigDiff(a, b []string) bool {
+	pre, suf := trimCommon(a, b)
+	return (len(a)-pre-suf+1)*(len(b)-pre-suf+1) > maxDiffCells
+}
+
+// walks the diff of a to b, found via their longest common subsequence,
+// calling op with ' ' for common, '-' for removed & '+' for added elements
+// -- only the part between any common start & end is diffed, and if that
+// is too large (see maxDiffCells) it is all shown as removed then added
+func diff(a, b []string, op func(byte, string)) {
+	pre, suf := trimCommon(a, b)
+	for _, s := range a[:pre] {
+		op(' ', s)
+	}
+	defer func(end []string) {
+		for _, s := range end {
+			op(' ', s)
+		}
+	}(a[len(a)-suf:])
+	a, b = a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, s := range a {
+			op('-', s)
+		}
+		for _, s := range b {
+			op('+', s)
+		}
+		return
+	}
+	lcs := make([][]int, len(a)+1) // lcs[i][j] is the LCS length of a[i:] & b[j:]
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			op(' ', a[i])
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			op('-', a[i])
+			i++
+		default:
+			op('+', b[j])
+			j++
+		}
+	}
+}
+
+// returns the runes of s, each as a string for diff
+func runeStrs(s string) []string {
+	var rs []string
+	for _, r := range s {
+		rs = append(rs, string(r))
+	}
+	return rs
+}
+
+// returns text showing how got differs from want: a diff from want to got when
+// both are strings (by line if either has several lines, otherwise by rune),
+// or just got= & want= for other values or strings too long to diff
+func eqDiff(got, want interface{}) string {
+	g, gs := got.(string)
+	w, ws := want.(string)
+	if gs && ws {
+		if strings.Contains(g, "\n") || strings.Contains(w, "\n") {
+			if wl, gl := strings.Split(w, "\n"), strings.Split(g, "\n"); !bigDiff(wl, gl) {
+				return diffText(wl, gl)
+			}
+		} else if !bigDiff(runeStrs(w), runeStrs(g)) {
+			return "  " + inlineDiff(w, g) + "\n"
+		}
+	}
+	return fmt.Sprintf("  got=%#v\n  want=%#v\n", got, want)
+}
+
+// output nested maps, slices, arrays & structs as an indented tree
+func Tree(label string, v interface{}) {
+	if !active(MsgLevel) {
+		return
+	}
+	cs := curColors()
+	var b strings.Builder
+	b.WriteString(cs.msg + label + cs.norm + "\n")
+	tree(&b, "", reflect.ValueOf(v), map[uintptr]bool{})
+	output(MsgLevel, "%s", b.String())
+}
+
+// returns the value with any pointers & interfaces removed, along with the
+// address of any pointer, map or slice data for detecting cycles
+func treeElem(v reflect.Value) (reflect.Value, uintptr) {
+	var p uintptr
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, 0
+		}
+		if v.Kind() == reflect.Ptr {
+			p = v.Pointer()
+		}
+		v = v.Elem()
+	}
+	if (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && !v.IsNil() {
+		p = v.Pointer()
+	}
+	return v, p
+}
+
+// add the branches of the value to the tree, each line starting with indent
+func tree(b *strings.Builder, indent string, v reflect.Value, seen map[uintptr]bool) {
+	cs := curColors()
+	v, p := treeElem(v)
+	if 0 != p {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+		defer delete(seen, p)
+	}
+
+	var keys []string
+	var vals []reflect.Value
+	switch v.Kind() {
+	case reflect.Map:
+		mk := v.MapKeys()
+		sort.Slice(mk, func(i, j int) bool { return fmt.Sprint(mk[i]) < fmt.Sprint(mk[j]) })
+		for _, k := range mk {
+			keys = append(keys, fmt.Sprint(k))
+			vals = append(vals, v.MapIndex(k))
+		}
+	case reflect.Slice, reflect.Array:
+		for n := 0; n < v.Len(); n++ {
+			keys = append(keys, fmt.Sprintf("[%d]", n))
+			vals = append(vals, v.Index(n))
+		}
+	case reflect.Struct:
+		for n := 0; n < v.NumField(); n++ {
+			keys = append(keys, v.Type().Field(n).Name)
+			vals = append(vals, v.Field(n))
+		}
+	}
+
+	for n, k := range keys {
+		branch, more := "├── ", "│   "
+		if n == len(keys)-1 {
+			branch, more = "└── ", "    "
+		}
+		e, ep := treeElem(vals[n])
+		switch {
+		case 0 != ep && seen[ep]:
+			b.WriteString(indent + branch + k + ": " + cs.warn + "<cycle>" + cs.norm + "\n")
+		case isBranch(e):
+			b.WriteString(indent + branch + k + "\n")
+			tree(b, indent+more, vals[n], seen)
+		default:
+			b.WriteString(fmt.Sprintf("%s%s%s: %v\n", indent, branch, k, e))
+		}
+	}
+}
+
+// returns true if the value has branches for the tree
+func isBranch(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() > 0
+	case reflect.Struct:
+		return v.NumField() > 0
+	}
+	return false
+}
+
+// register the names of the values of an enum type for use by Enum, replacing
+// any names already registered for the type
+func RegisterEnum(typeName string, names map[int]string) {
+	m := make(map[int]string, len(names))
+	for v, nm := range names {
+		m[v] = nm
+	}
+	enumMu.Lock()
+	defer enumMu.Unlock()
+	enums[typeName] = m
+}
+
+// returns the registered name of the value as typeName(NAME), e.g. State(RUNNING),
+// falling back to typeName(v) for unknown types or values
+func Enum(typeName string, v int) string {
+	enumMu.Lock()
+	defer enumMu.Unlock()
+	if nm, ok := enums[typeName][v]; ok {
+		return typeName + "(" + nm + ")"
+	}
+	return fmt.Sprintf("%s(%d)", typeName, v)
+}
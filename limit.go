@@ -0,0 +1,122 @@
+package dbg
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limiting of repeated output lines, see SetRateLimit
+type rateLimit struct {
+	mu      sync.Mutex
+	every   time.Duration        // 0 when disabled
+	seen    map[string]time.Time // when each line was last output
+	repeats map[string]int       // number of times each line was suppressed
+}
+
+var rate rateLimit
+
+// suppress any line that is identical to one output within the last d, on
+// the next line output a '(repeated N times)' summary of the suppressed lines
+// is output first, Fatal / danger output is never suppressed -- a d of 0 (the
+// default) disables the limit
+func SetRateLimit(d time.Duration) {
+	rate.mu.Lock()
+	defer rate.mu.Unlock()
+	rate.every = d
+	rate.seen = map[string]time.Time{}
+	rate.repeats = map[string]int{}
+}
+
+// returns false if the line should be suppressed, otherwise returns any
+// summary text of previously suppressed lines to output before it
+func (r *rateLimit) allow(l Level, s string) (string, bool) {
+	cs := curColors()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if 0 == r.every || DangerLevel == l || '\n' != s[len(s)-1] { // only complete lines are limited
+		return "", true
+	}
+	t0 := now()
+	if t, ok := r.seen[s]; ok && t0.Sub(t) < r.every {
+		r.repeats[s]++
+		return "", false
+	}
+	if len(r.seen) > 256 { // don't keep lines outside of the limit forever
+		for k, t := range r.seen {
+			if t0.Sub(t) >= r.every && 0 == r.repeats[k] {
+				delete(r.seen, k)
+			}
+		}
+	}
+	r.seen[s] = t0
+
+	lines := make([]string, 0, len(r.repeats))
+	for k := range r.repeats {
+		lines = append(lines, k)
+	}
+	sort.Strings(lines)
+	sum := ""
+	for _, k := range lines {
+		sum += fmt.Sprintf("%s(repeated %d times)%s %s", cs.stat, r.repeats[k], cs.norm, k)
+		delete(r.repeats, k)
+	}
+	return sum, true
+}
+
+// Throttling of output by a token bucket, see SetBurst
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity int           // 0 when disabled
+	refill   time.Duration // time to refill a single token
+	tokens   int           // lines that can be output before throttling
+	last     time.Time     // when tokens were last refilled
+	dropped  int           // number of lines throttled since the last output
+}
+
+var burst tokenBucket
+
+// allow bursts of up to capacity lines of output, throttling any more until
+// tokens refill at one per refill duration -- on the next line output a
+// '(throttled, N suppressed)' summary is output first, Fatal / danger output is
+// never throttled -- a capacity of 0 (the default) disables throttling
+func SetBurst(capacity int, refill time.Duration) {
+	burst.mu.Lock()
+	defer burst.mu.Unlock()
+	if capacity < 0 || refill <= 0 {
+		capacity = 0
+	}
+	burst.capacity, burst.refill = capacity, refill
+	burst.tokens, burst.last, burst.dropped = capacity, now(), 0
+}
+
+// returns false if the output should be throttled, otherwise returns any
+// summary text of previously throttled output to output before it
+func (b *tokenBucket) allow(l Level) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if 0 == b.capacity || DangerLevel == l {
+		return "", true
+	}
+	t0 := now()
+	if n := int(t0.Sub(b.last) / b.refill); n > 0 {
+		b.tokens += n
+		b.last = b.last.Add(time.Duration(n) * b.refill)
+	}
+	if b.tokens >= b.capacity {
+		b.tokens, b.last = b.capacity, t0
+	}
+	if 0 == b.tokens {
+		b.dropped++
+		return "", false
+	}
+	b.tokens--
+	if 0 == b.dropped {
+		return "", true
+	}
+	cs := curColors()
+	sum := fmt.Sprintf("%s(throttled, %d suppressed)%s\n", cs.stat, b.dropped, cs.norm)
+	b.dropped = 0
+	return sum, true
+}
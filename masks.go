@@ -0,0 +1,90 @@
+package dbg
+
+import "sync"
+
+// Named bits of DbgMsk masks
+
+var (
+	maskMu sync.RWMutex
+	masks  = map[string]uint32{} // mask bit(s) of each name, see RegisterMask
+)
+
+// register name as the mask bit(s) for the DbgMsk named funcs (InfoN, ...),
+// e.g. RegisterMask("parser", 0x4) -- re-registering a name replaces its bits
+func RegisterMask(name string, bit uint32) {
+	maskMu.Lock()
+	defer maskMu.Unlock()
+	masks[name] = bit
+}
+
+// returns the mask bit(s) registered for name, 0 (no output) if not registered
+func maskOf(name string) uint32 {
+	maskMu.RLock()
+	defer maskMu.RUnlock()
+	return masks[name]
+}
+
+// enable output of the named mask bit(s)
+func (d *DbgMsk) Enable(name string) {
+	d.Mask |= maskOf(name)
+}
+
+// disable output of the named mask bit(s)
+func (d *DbgMsk) Disable(name string) {
+	d.Mask &^= maskOf(name)
+}
+
+// returns true if any of the named mask bit(s) are enabled
+func (d DbgMsk) Enabled(name string) bool {
+	return 0 != d.Mask&maskOf(name)
+}
+
+// simply echo to output if the named mask is enabled
+func (d DbgMsk) EchoN(name string, fstr string, a ...interface{}) {
+	d.Echo(maskOf(name), fstr, a...)
+}
+
+// cyan text to output if the named mask is enabled
+func (d DbgMsk) MessageN(name string, fstr string, a ...interface{}) {
+	d.Message(maskOf(name), fstr, a...)
+}
+
+// green text to output if the named mask is enabled
+func (d DbgMsk) InfoN(name string, fstr string, a ...interface{}) {
+	d.Info(maskOf(name), fstr, a...)
+}
+
+// blue text to output if the named mask is enabled
+func (d DbgMsk) NoteN(name string, fstr string, a ...interface{}) {
+	d.Note(maskOf(name), fstr, a...)
+}
+
+// gray text to output if the named mask is enabled
+func (d DbgMsk) StatusN(name string, fstr string, a ...interface{}) {
+	d.Status(maskOf(name), fstr, a...)
+}
+
+// orange text to output if the named mask is enabled
+func (d DbgMsk) WarningN(name string, fstr string, a ...interface{}) {
+	d.Warning(maskOf(name), fstr, a...)
+}
+
+// yellow (bright orange) text to output if the named mask is enabled
+func (d DbgMsk) CautionN(name string, fstr string, a ...interface{}) {
+	d.Caution(maskOf(name), fstr, a...)
+}
+
+// magenta text to output if the named mask is enabled
+func (d DbgMsk) FailedN(name string, fstr string, a ...interface{}) {
+	d.Failed(maskOf(name), fstr, a...)
+}
+
+// red text to output if the named mask is enabled
+func (d DbgMsk) ErrorN(name string, fstr string, a ...interface{}) {
+	d.Error(maskOf(name), fstr, a...)
+}
+
+// bold white on red background text to output if the named mask is enabled
+func (d DbgMsk) DangerN(name string, fstr string, a ...interface{}) {
+	d.Danger(maskOf(name), fstr, a...)
+}
@@ -0,0 +1,67 @@
+package dbg
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Output only the first time, for messages that would otherwise repeat
+
+var (
+	onceMu   sync.Mutex
+	onceSeen = map[string]bool{} // keys already seen by Once
+	nthCalls = map[string]int{}  // calls of InfoNth by call site
+)
+
+// run fn only the first time the key is seen, e.g. for a deprecation notice:
+//
+//	dbg.Once("deprecated-api", func() { dbg.Warning("X is deprecated") })
+func Once(key string, fn func()) {
+	onceMu.Lock()
+	seen := onceSeen[key]
+	onceSeen[key] = true
+	onceMu.Unlock()
+	if !seen {
+		fn()
+	}
+}
+
+// orange text to output, but only the first time for the format string --
+// calls while Warning output is filtered aren't counted
+func WarningOnce(fstr string, a ...interface{}) {
+	if !active(WarnLevel) {
+		return
+	}
+	cs := curColors()
+	Once("WarningOnce:"+fstr, func() {
+		output(WarnLevel, locFor(WarnLevel)+cs.warn+fstr+cs.norm+"\n", a...)
+	})
+}
+
+// green text to output, but only on exactly the nth call from the call site,
+// e.g. to catch a specific iteration of a loop -- calls while Info output is
+// filtered aren't counted
+func InfoNth(n int, fstr string, a ...interface{}) {
+	if !active(InfoLevel) {
+		return
+	}
+	cs := curColors()
+	_, file, line, _ := caller(1)
+	site := fmt.Sprintf("%s:%d", file, line)
+	onceMu.Lock()
+	nthCalls[site]++
+	hit := nthCalls[site] == n
+	onceMu.Unlock()
+	if hit {
+		output(InfoLevel, locFor(InfoLevel)+cs.info+fstr+cs.norm+"\n", a...)
+	}
+}
+
+// forget all keys seen by Once (& WarningOnce) so they run again, and the
+// call counts of InfoNth
+func ResetOnce() {
+	onceMu.Lock()
+	onceSeen = map[string]bool{}
+	nthCalls = map[string]int{}
+	onceMu.Unlock()
+}
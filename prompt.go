@@ -0,0 +1,62 @@
+package dbg
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Prompting for input without debug output clobbering the prompt
+
+// output held while paused, see write
+type heldOut struct {
+	w    io.Writer
+	sink func(string, ...interface{})
+	s    string
+}
+
+var (
+	stdin    = bufio.NewReader(os.Stdin) // where Prompt reads its answers
+	promptMu sync.Mutex                  // one Prompt at a time
+	paused   bool                        // true while Prompt holds output, guarded by outMu
+	held     []heldOut                   // output held while paused, guarded by outMu
+)
+
+// output the question and return the line (without the newline) read from
+// stdin in answer -- any output while waiting for the answer (including that
+// to tees) is held and output once answered, so it doesn't clobber the
+// prompt, unless a Flush (as done by the fatal & panic funcs) outputs it first
+func Prompt(question string) string {
+	cs := curColors()
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	outMu.Lock()
+	curConfig().outSink("%s", cs.msg+question+cs.norm)
+	paused = true
+	outMu.Unlock()
+	defer resume()
+
+	ans, _ := stdin.ReadString('\n')
+	return strings.TrimRight(ans, "\r\n")
+}
+
+// output anything held while paused and resume normal output
+func resume() {
+	outMu.Lock()
+	defer outMu.Unlock()
+	paused = false
+	outputHeld()
+}
+
+// output anything held while paused, even if still paused -- outMu must be held
+func outputHeld() {
+	h, p := held, paused
+	held, paused = nil, false
+	for _, o := range h {
+		write(o.w, o.sink, o.s)
+	}
+	paused = p
+}
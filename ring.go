@@ -0,0 +1,72 @@
+package dbg
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+// A ring buffer of the last N lines output (uncolored), for dumping when an
+// error finally happens -- see EnableRingBuffer
+type ring struct {
+	mu    sync.Mutex
+	lines []string // nil when disabled
+	next  int      // where the next line goes
+	full  bool     // set once lines has wrapped
+	part  string   // partial line not yet ended with a newline
+}
+
+var ringBuf ring
+
+// keep a copy of the last n lines of output (0 to disable) -- the lines can
+// then be output with DumpRingBuffer
+func EnableRingBuffer(n int) {
+	ringBuf.mu.Lock()
+	defer ringBuf.mu.Unlock()
+	ringBuf.lines, ringBuf.next, ringBuf.full, ringBuf.part = nil, 0, false, ""
+	if n > 0 {
+		ringBuf.lines = make([]string, n)
+	}
+}
+
+// write the lines kept by EnableRingBuffer to w, oldest first
+func DumpRingBuffer(w io.Writer) {
+	ringBuf.mu.Lock()
+	defer ringBuf.mu.Unlock()
+	if ringBuf.full {
+		for _, l := range ringBuf.lines[ringBuf.next:] {
+			io.WriteString(w, l+"\n")
+		}
+	}
+	for _, l := range ringBuf.lines[:ringBuf.next] {
+		io.WriteString(w, l+"\n")
+	}
+}
+
+// clear any lines kept by EnableRingBuffer
+func ClearRingBuffer() {
+	ringBuf.mu.Lock()
+	defer ringBuf.mu.Unlock()
+	ringBuf.next, ringBuf.full, ringBuf.part = 0, false, ""
+}
+
+// add output text to the ring, overwriting the oldest line when full
+func (r *ring) add(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if nil == r.lines {
+		return
+	}
+	r.part += stripColor(s)
+	for {
+		n := strings.IndexByte(r.part, '\n')
+		if n < 0 {
+			break
+		}
+		r.lines[r.next] = r.part[:n]
+		r.part = r.part[n+1:]
+		if r.next++; r.next == len(r.lines) {
+			r.next, r.full = 0, true
+		}
+	}
+}
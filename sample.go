@@ -0,0 +1,95 @@
+package dbg
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sampling of output on hot paths
+
+var (
+	sampleMu  sync.Mutex
+	sampleRng = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sampleEvery int32 // output 1 of every N calls of each call site, 0 for all
+	siteMu      sync.Mutex
+	siteCalls   = map[string]int{} // calls of each call site while sampling
+	siteSkips   = map[string]int{} // calls of each call site skipped since its last output
+)
+
+// seed the generator used for sampled output, for reproducible tests
+func SetSampleSeed(seed int64) {
+	sampleMu.Lock()
+	defer sampleMu.Unlock()
+	sampleRng = rand.New(rand.NewSource(seed))
+}
+
+// returns true with a probability of p (0..1)
+func sampled(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	if p >= 1 {
+		return true
+	}
+	sampleMu.Lock()
+	defer sampleMu.Unlock()
+	return sampleRng.Float64() < p
+}
+
+// green text to output with a probability of p (0..1), for statistical
+// sampling of very hot paths
+func InfoProb(p float64, fstr string, a ...interface{}) {
+	cs := curColors()
+	if active(InfoLevel) && sampled(p) {
+		output(InfoLevel, locFor(InfoLevel)+cs.info+fstr+cs.norm+"\n", a...)
+	}
+}
+
+// output only 1 of every n calls of each call site (file & line), the first
+// call and every n-th after it, noting '(sampled, N suppressed)' on the
+// output lines following any skipped -- n <= 1 (the default) outputs all
+// calls, Fatal / danger output is never sampled
+func SetSample(n int) {
+	if n <= 1 {
+		n = 0
+	}
+	siteMu.Lock()
+	defer siteMu.Unlock()
+	atomic.StoreInt32(&sampleEvery, int32(n))
+	siteCalls = map[string]int{}
+	siteSkips = map[string]int{}
+}
+
+// returns false if the output of the callers call site is to be skipped,
+// otherwise returns any note of the calls skipped since its last output
+func sampleSite(l Level) (string, bool) {
+	n := int(atomic.LoadInt32(&sampleEvery))
+	if 0 == n || DangerLevel == l {
+		return "", true
+	}
+	_, file, line, ok := userCaller()
+	if !ok {
+		return "", true
+	}
+	site := file + ":" + strconv.Itoa(line)
+	siteMu.Lock()
+	defer siteMu.Unlock()
+	c := siteCalls[site]
+	siteCalls[site] = c + 1
+	if 0 != c%n {
+		siteSkips[site]++
+		return "", false
+	}
+	skips := siteSkips[site]
+	if 0 == skips {
+		return "", true
+	}
+	delete(siteSkips, site)
+	cs := curColors()
+	return fmt.Sprintf(" %s(sampled, %d suppressed)%s", cs.stat, skips, cs.norm), true
+}
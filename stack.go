@@ -0,0 +1,200 @@
+package dbg
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Stack dumping helpers
+
+const maxStackBuf = 8 << 20 // largest buffer used for dumping all goroutine stacks
+
+var (
+	autoStack int32     // non-zero to add the callers stack to error output
+	autoDepth int32 = 5 // most frames added to error output by the auto stack
+	chkDepth  int32 = 3 // most frames output by ChkErrS
+)
+
+// A single call stack frame, see CaptureStack
+type Frame struct {
+	Func string // fully qualified func name
+	File string // full path of the source file
+	Dir  string // directory of the source file
+	Line int
+}
+
+// returns up to depth frames of the callers stack, skipping 'skip' frames -- 0
+// for the func calling CaptureStack
+func CaptureStack(depth, skip int) []Frame {
+	return captureStack(depth, skip+1)
+}
+
+// returns up to depth frames of the stack, 'skip' steps back from the caller
+func captureStack(depth, skip int) []Frame {
+	if depth <= 0 {
+		return nil
+	}
+	pcs := make([]uintptr, depth)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(skip+2, pcs)])
+	var fs []Frame
+	for len(fs) < depth {
+		f, more := frames.Next()
+		if 0 == f.Line {
+			break
+		}
+		fs = append(fs, Frame{f.Function, f.File, path.Dir(f.File), f.Line})
+		if !more {
+			break
+		}
+	}
+	return fs
+}
+
+// add the callers stack to all error (ErrLevel) output, see SetAutoStackDepth
+func EnableAutoStack(on bool) {
+	if on {
+		atomic.StoreInt32(&autoStack, 1)
+	} else {
+		atomic.StoreInt32(&autoStack, 0)
+	}
+}
+
+// set the most frames added to error output by EnableAutoStack (default 5)
+func SetAutoStackDepth(n int) {
+	atomic.StoreInt32(&autoDepth, int32(n))
+}
+
+// set the most frames output below the error by ChkErrS (default 3)
+func SetChkStackDepth(n int) {
+	atomic.StoreInt32(&chkDepth, int32(n))
+}
+
+// returns up to depth frames of the callers stack as text for the auto stack,
+// skipping any frames of the runtime & dbg
+func autoStackText(depth int) string {
+	cs := curColors()
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	var b strings.Builder
+	for n := 0; n < depth; {
+		f, more := frames.Next()
+		if f.Line > 0 && !isRuntime(f.Function) && !isDbg(f.File) {
+			b.WriteString(cs.err + "  " + Frame{f.Function, f.File, path.Dir(f.File), f.Line}.String() + cs.norm + "\n")
+			n++
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// returns the frame as text, as output by StackTrace
+func (f Frame) String() string {
+	return fmt.Sprintf("Func: %s - %d   %s", f.Func, f.Line, f.Dir)
+}
+
+// returns the callers stack (up to ten levels deep) as text, a line per frame
+func StackString() string {
+	var b strings.Builder
+	for _, f := range captureStack(10, 1) {
+		b.WriteString(f.String() + "\n")
+	}
+	return b.String()
+}
+
+// returns the stacks of all goroutines, as for a SIGQUIT
+func allStacks() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStackBuf {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// output the stacks of all goroutines (like a SIGQUIT but without exiting), to
+// aid in diagnosing deadlocks & hangs
+func AllStacks() {
+	if !active(WarnLevel) {
+		return
+	}
+	cs := curColors()
+	var b strings.Builder
+	for _, l := range strings.Split(strings.TrimRight(allStacks(), "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(l, "goroutine "):
+			b.WriteString(cs.msg + l + cs.norm + "\n")
+		case strings.HasPrefix(l, "\t"):
+			b.WriteString(cs.stat + l + cs.norm + "\n")
+		case "" == l:
+			b.WriteString("\n")
+		default:
+			b.WriteString(cs.warn + l + cs.norm + "\n")
+		}
+	}
+	output(WarnLevel, "%s", b.String())
+}
+
+var (
+	dumpMu   sync.Mutex
+	dumpSigs chan os.Signal // nil when no dump handler is installed
+)
+
+// install a handler that, on receiving the signal, outputs a snapshot of the
+// process: all goroutine stacks, memory stats & any ring buffer -- like a
+// SIGQUIT but the process keeps running, replaces any handler already installed
+func InstallDumpHandler(sig os.Signal) {
+	UninstallDumpHandler()
+	dumpMu.Lock()
+	defer dumpMu.Unlock()
+	dumpSigs = make(chan os.Signal, 1)
+	signal.Notify(dumpSigs, sig)
+	go func(c chan os.Signal) {
+		for range c {
+			DumpState()
+		}
+	}(dumpSigs)
+}
+
+// remove any handler installed by InstallDumpHandler
+func UninstallDumpHandler() {
+	dumpMu.Lock()
+	defer dumpMu.Unlock()
+	if nil != dumpSigs {
+		signal.Stop(dumpSigs)
+		close(dumpSigs)
+		dumpSigs = nil
+	}
+}
+
+// output a snapshot of the process: all goroutine stacks, memory stats & any
+// lines kept by EnableRingBuffer
+func DumpState() {
+	if !active(WarnLevel) {
+		return
+	}
+	cs := curColors()
+	var b strings.Builder
+	DumpRingBuffer(&b) // before the dump's own output lands in the ring
+
+	output(WarnLevel, "%s\n", cs.blkWARNING+" STATE DUMP "+cs.norm)
+	AllStacks()
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	output(WarnLevel, "%sMemStats: Alloc=%d TotalAlloc=%d Sys=%d HeapObjects=%d NumGC=%d Goroutines=%d%s\n",
+		cs.msg, m.Alloc, m.TotalAlloc, m.Sys, m.HeapObjects, m.NumGC, runtime.NumGoroutine(), cs.norm)
+
+	if 0 != b.Len() {
+		output(WarnLevel, "%s\n%s", cs.msg+"Ring buffer:"+cs.norm, b.String())
+	}
+}
@@ -0,0 +1,49 @@
+package dbg
+
+import "sync"
+
+// Choice of the output stream of each level
+
+// The stream output of a level goes to, see SetStream
+type Stream int
+
+const (
+	DefaultStream Stream = iota // the stream the output func normally uses (Failed & Error to stderr)
+	OutStream                   // normal output (stdout unless set by SetOutput)
+	ErrStream                   // error output (stderr unless set by SetOutput)
+)
+
+var (
+	streamMu sync.Mutex
+	streams  = map[Level]Stream{} // levels sent to other than their default stream
+)
+
+// send all output at the given level to the stream, e.g. so Danger output
+// goes to stderr along with Failed & Error output:
+//
+//	dbg.SetStream(dbg.DangerLevel, dbg.ErrStream)
+//
+// DefaultStream restores the level to the stream each output func uses
+func SetStream(l Level, s Stream) {
+	streamMu.Lock()
+	defer streamMu.Unlock()
+	if DefaultStream == s {
+		delete(streams, l)
+	} else {
+		streams[l] = s
+	}
+}
+
+// returns the sink of the stream set for the level, otherwise the given sink
+func streamSink(l Level, sink func(string, ...interface{})) func(string, ...interface{}) {
+	streamMu.Lock()
+	s := streams[l]
+	streamMu.Unlock()
+	switch s {
+	case OutStream:
+		return curConfig().outSink
+	case ErrStream:
+		return curConfig().errSink
+	}
+	return sink
+}
@@ -0,0 +1,39 @@
+package dbg
+
+import (
+	"time"
+)
+
+// Stopwatch for quick timing of code
+
+// A stopwatch started by Start, each Timer is independent of any other
+type Timer struct {
+	Label string
+	Began time.Time
+}
+
+// returns a Timer for the label started now, output its time with Stop:
+//
+//	t := dbg.Start("phase")
+//	...
+//	t.Stop()
+func Start(label string) Timer {
+	return Timer{label, now()}
+}
+
+// output the time since the timer was started, e.g. 'phase took 1.23ms'
+func (t Timer) Stop() {
+	cs := curColors()
+	if active(StatLevel) {
+		output(StatLevel, "%s\n", cs.stat+t.Label+" took "+now().Sub(t.Began).String()+cs.norm)
+	}
+}
+
+// output the time since the timer was started for an intermediate split,
+// e.g. 'phase: parsed at 1.23ms'
+func (t Timer) Lap(name string) {
+	cs := curColors()
+	if active(StatLevel) {
+		output(StatLevel, "%s\n", cs.stat+t.Label+": "+name+" at "+now().Sub(t.Began).String()+cs.norm)
+	}
+}
@@ -0,0 +1,108 @@
+package dbg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TRC of values named by the expressions passed, read from the callers source
+
+type srcFile struct {
+	fset *token.FileSet
+	file *ast.File
+	src  []byte
+}
+
+var (
+	srcMu    sync.Mutex
+	srcFiles = map[string]*srcFile{} // parsed source files, nil if unreadable
+)
+
+// output the callers location (as TRC) followed by each value as 'expr = value'
+// with the expression passed for it taken from the callers source, e.g.
+//
+//	dbg.TRCV(user, count)   // TRC @ 12 in app/main.go  user = {Name:bob}  count = 3
+//
+// if the source can't be read the values are output as '[0] = value', ...
+func TRCV(vals ...interface{}) {
+	if !active(TrcLevel) {
+		return
+	}
+	cs := curColors()
+	loc := ""
+	var names []string
+	if _, file, line, ok := caller(1); ok {
+		c := curConfig()
+		loc = fmt.Sprintf("%s@ %d in %s%s", c.tags[trcTag], line, shortName(file), c.locSep)
+		names = callArgs(file, line, "TRCV", len(vals))
+	}
+	txt := make([]string, len(vals))
+	for n, v := range vals {
+		name := fmt.Sprintf("[%d]", n)
+		if nil != names {
+			name = names[n]
+		}
+		txt[n] = fmt.Sprintf("%s = %+v", cs.msg+name+cs.norm, v)
+	}
+	output(TrcLevel, "%s%s\n", loc, strings.Join(txt, "  "))
+}
+
+// returns the source text of each arg of the call of fn at the line of the
+// file, nil if the file can't be read or no call with n args is found
+func callArgs(file string, line int, fn string, n int) []string {
+	srcMu.Lock()
+	sf, ok := srcFiles[file]
+	if !ok {
+		sf = parseSrc(file)
+		srcFiles[file] = sf
+	}
+	srcMu.Unlock()
+	if nil == sf {
+		return nil
+	}
+	var args []string
+	ast.Inspect(sf.file, func(nd ast.Node) bool {
+		c, ok := nd.(*ast.CallExpr)
+		if nil != args || !ok || n != len(c.Args) || c.Ellipsis.IsValid() || line != sf.fset.Position(c.Lparen).Line {
+			return nil == args
+		}
+		if !callsFunc(c, fn) {
+			return true
+		}
+		for _, a := range c.Args {
+			args = append(args, string(sf.src[sf.fset.Position(a.Pos()).Offset:sf.fset.Position(a.End()).Offset]))
+		}
+		return false
+	})
+	return args
+}
+
+// returns true if the call is of the func (or method) named fn
+func callsFunc(c *ast.CallExpr, fn string) bool {
+	switch f := c.Fun.(type) {
+	case *ast.Ident:
+		return fn == f.Name
+	case *ast.SelectorExpr:
+		return fn == f.Sel.Name
+	}
+	return false
+}
+
+// returns the parsed source file, nil if it can't be read or parsed
+func parseSrc(file string) *srcFile {
+	src, err := os.ReadFile(file)
+	if nil != err {
+		return nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, src, 0)
+	if nil != err {
+		return nil
+	}
+	return &srcFile{fset, f, src}
+}
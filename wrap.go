@@ -0,0 +1,87 @@
+package dbg
+
+import (
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Soft wrapping of long output lines
+
+const hangIndent = 4 // indent of the continuation of a wrapped line
+
+var maxWidth int32 // column output lines are wrapped at, 0 for no wrapping
+
+// soft wrap output lines longer than cols columns (not counting any color
+// escape sequences), breaking at the last space if there is one and indenting
+// the continuation -- 0 (the default) turns off wrapping
+func SetMaxWidth(cols int) {
+	if cols < 0 {
+		cols = 0
+	}
+	atomic.StoreInt32(&maxWidth, int32(cols))
+}
+
+// returns the number of columns of s, not counting any color escape sequences
+func visLen(s string) int {
+	return utf8.RuneCountInString(stripColor(s))
+}
+
+// returns the length of the color escape sequence (\033[...m) starting s, 0 if none
+func escLen(s string) int {
+	if !strings.HasPrefix(s, "\033[") {
+		return 0
+	}
+	if n := strings.IndexByte(s, 'm'); n > 0 {
+		return n + 1
+	}
+	return 0
+}
+
+// returns the text with each line longer than cols columns wrapped
+func wrapText(s string, cols int) string {
+	lines := strings.Split(s, "\n")
+	for n, ln := range lines {
+		if visLen(ln) > cols {
+			lines[n] = wrapLine(ln, cols)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// returns the line wrapped at cols columns
+func wrapLine(ln string, cols int) string {
+	ind := hangIndent
+	if ind > cols/2 {
+		ind = cols / 2
+	}
+	indent := strings.Repeat(" ", ind)
+	var b strings.Builder
+	cur, w, sp := "", 0, -1 // sp is the index in cur of its last space, -1 if none
+	for n := 0; n < len(ln); {
+		if e := escLen(ln[n:]); e > 0 {
+			cur += ln[n : n+e]
+			n += e
+			continue
+		}
+		if w >= cols {
+			if sp > 0 {
+				b.WriteString(cur[:sp] + "\n")
+				cur = indent + cur[sp+1:]
+			} else {
+				b.WriteString(cur + "\n")
+				cur = indent
+			}
+			w, sp = visLen(cur), -1
+		}
+		_, size := utf8.DecodeRuneInString(ln[n:])
+		if ' ' == ln[n] {
+			sp = len(cur)
+		}
+		cur += ln[n : n+size]
+		w++
+		n += size
+	}
+	b.WriteString(cur)
+	return b.String()
+}
@@ -0,0 +1,240 @@
+package dbg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Output to io.Writers
+
+var (
+	stripOut int32    // stripAuto, stripOn or stripOff, see SetStripColor
+	ttys     sync.Map // *os.File -> bool, if the file is a terminal, see isTerminal
+
+	teeMu sync.Mutex
+	tees  []teeW // writers also getting all output, see AddTee
+)
+
+// Stripping of color from output, see SetStripColor
+const (
+	stripAuto int32 = iota // strip color from output to writers that aren't terminals
+	stripOn                // strip color from all output
+	stripOff               // keep color in all output
+)
+
+type teeW struct {
+	w     io.Writer
+	strip bool // strip color from the output written to w
+}
+
+// send all output (both output & error) to w, nil restores the normal
+// stdout & stderr output -- if w isn't a terminal any color is stripped from
+// the output, undoing any SetStripColor
+func SetOutput(w io.Writer) {
+	atomic.StoreInt32(&stripOut, stripAuto)
+	if nil == w {
+		changeConfig(func(c *settings) {
+			c.outSink, c.errSink, c.outW, c.errW = stdout, errout, os.Stdout, os.Stderr
+		})
+		return
+	}
+	out := func(f string, a ...interface{}) {
+		writeTo(w, fmt.Sprintf(f, a...))
+	}
+	changeConfig(func(c *settings) {
+		c.outSink, c.errSink, c.outW, c.errW = out, out, w, w
+	})
+}
+
+// send all output to w (as SetOutput) until the returned func is called to
+// restore both the normal & error output as they were, nested uses must be
+// restored in LIFO order, as they are when deferred:
+//
+//	defer dbg.WithWriter(buf)()
+func WithWriter(w io.Writer) func() {
+	prev := curConfig()
+	strip := atomic.LoadInt32(&stripOut)
+	SetOutput(w)
+	return func() {
+		changeConfig(func(c *settings) {
+			c.outSink, c.errSink, c.outW, c.errW = prev.outSink, prev.errSink, prev.outW, prev.errW
+		})
+		atomic.StoreInt32(&stripOut, strip)
+	}
+}
+
+// flush any buffering of the output & error writers, calling Flush or Sync
+// if the writer has either, returns the first error of doing so -- called
+// by the fatal & panic funcs so the last output before them isn't lost, any
+// output held by a Prompt is output first
+func Flush() error {
+	outMu.Lock()
+	defer outMu.Unlock()
+	outputHeld()
+	c := curConfig()
+	err := flushWriter(c.outW)
+	if e := flushWriter(c.errW); nil == err {
+		err = e
+	}
+	return err
+}
+
+// flush any buffering of w, calling Flush or Sync if it has either
+func flushWriter(w io.Writer) error {
+	switch f := w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case *os.File:
+		if fi, err := f.Stat(); nil == err && fi.Mode().IsRegular() {
+			return f.Sync() // terminals & pipes can't be synced
+		}
+	case interface{ Sync() error }:
+		return f.Sync()
+	}
+	return nil
+}
+
+// also write all output to w, e.g. a plain text audit file (strip true to
+// strip any color from the output it gets) -- output goes to each tee in
+// addition to the normal output, ring buffer, ...
+func AddTee(w io.Writer, strip bool) {
+	teeMu.Lock()
+	defer teeMu.Unlock()
+	tees = append(tees, teeW{w, strip})
+}
+
+// stop writing output to w, as added by AddTee
+func RemoveTee(w io.Writer) {
+	teeMu.Lock()
+	defer teeMu.Unlock()
+	for n := range tees {
+		if tees[n].w == w {
+			tees = append(tees[:n:n], tees[n+1:]...)
+			return
+		}
+	}
+}
+
+// stop writing output to all writers added by AddTee
+func ClearTees() {
+	teeMu.Lock()
+	defer teeMu.Unlock()
+	tees = nil
+}
+
+// strip color escape sequences from all output (including that going to any
+// routed levels & Dbg writers) if on, or keep them in all output if not --
+// otherwise color is stripped from output to each writer that isn't a
+// terminal, as it is again after a SetOutput
+func SetStripColor(on bool) {
+	if on {
+		atomic.StoreInt32(&stripOut, stripOn)
+	} else {
+		atomic.StoreInt32(&stripOut, stripOff)
+	}
+}
+
+// returns true if color is to be stripped from output to w, as set by
+// SetStripColor or otherwise if w isn't a terminal
+func stripFor(w io.Writer) bool {
+	switch atomic.LoadInt32(&stripOut) {
+	case stripOn:
+		return true
+	case stripOff:
+		return false
+	}
+	return !isTerminal(w)
+}
+
+// write the output text to w, stripping any color if it should be (see stripFor)
+func writeTo(w io.Writer, s string) {
+	if stripFor(w) {
+		s = stripColor(s)
+	}
+	io.WriteString(w, s)
+}
+
+// returns true if w is a terminal (character device), the result for each
+// file being kept so output needn't stat the file every time
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	if t, ok := ttys.Load(f); ok {
+		return t.(bool)
+	}
+	t := false
+	if fi, err := f.Stat(); nil == err {
+		t = 0 != fi.Mode()&os.ModeCharDevice
+	}
+	ttys.Store(f, t)
+	return t
+}
+
+// send all output to a writer that is (re)connected with dial whenever a write
+// to it fails, e.g. to stream output to a remote viewer -- while unable to
+// connect the most recent output (up to 64K) is held to send on reconnection,
+// after a failed dial output is only held until the next dial is due (waiting
+// 100ms, doubling up to 30s) so an unreachable writer doesn't stall output
+func SetResilientOutput(dial func() (io.WriteCloser, error)) {
+	SetOutput(&resilient{dial: dial})
+}
+
+const (
+	maxPending = 64 * 1024              // most output held by a resilient writer while reconnecting
+	minRedial  = 100 * time.Millisecond // wait after a failed dial before dialing again
+	maxRedial  = 30 * time.Second       // longest wait between dials, doubling from minRedial
+)
+
+// writer that reconnects on write failure, see SetResilientOutput
+type resilient struct {
+	mu      sync.Mutex
+	dial    func() (io.WriteCloser, error)
+	w       io.WriteCloser // nil when not connected
+	pending []byte         // output not yet written
+	wait    time.Duration  // wait after the last failed dial, 0 once connected
+	redial  time.Time      // when the next dial is due after a failed dial
+}
+
+// writes p along with any pending output, reconnecting (at most once, and
+// only if a dial is due) on failure and holding onto the output if still
+// unable to write -- never fails
+func (r *resilient) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, p...)
+	if len(r.pending) > maxPending {
+		r.pending = r.pending[len(r.pending)-maxPending:]
+	}
+	for try := 0; try < 2; try++ {
+		if nil == r.w {
+			if now().Before(r.redial) {
+				break
+			}
+			w, err := r.dial()
+			if nil != err {
+				if r.wait *= 2; r.wait < minRedial {
+					r.wait = minRedial
+				} else if r.wait > maxRedial {
+					r.wait = maxRedial
+				}
+				r.redial = now().Add(r.wait)
+				break
+			}
+			r.w, r.wait = w, 0
+		}
+		if _, err := r.w.Write(r.pending); nil != err {
+			r.w.Close()
+			r.w = nil
+			continue
+		}
+		r.pending = r.pending[:0]
+		break
+	}
+	return len(p), nil
+}